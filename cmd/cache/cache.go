@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ironcladlou/prowdb/cmd/exit"
+	"github.com/ironcladlou/prowdb/prow"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func NewCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "cache",
+		Short: "Manages the local cache of bucket files.",
+	}
+
+	command.AddCommand(newStatsCommand())
+	command.AddCommand(newPruneCommand())
+
+	return command
+}
+
+func newStatsCommand() *cobra.Command {
+	var cacheDir string
+
+	var command = &cobra.Command{
+		Use:   "stats",
+		Short: "Reports the size of the cache.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cacheDir == "" {
+				return exit.Usage(errors.New("--cache-dir is required"))
+			}
+			stats, err := prow.NewCache(cacheDir).Stats()
+			if err != nil {
+				return err
+			}
+			return printStats(stats)
+		},
+	}
+
+	command.Flags().StringVarP(&cacheDir, "cache-dir", "", "", "cache directory")
+
+	return command
+}
+
+type pruneOptions struct {
+	CacheDir string
+	MaxAge   time.Duration
+	MaxSize  string
+}
+
+func newPruneCommand() *cobra.Command {
+	var options pruneOptions
+
+	var command = &cobra.Command{
+		Use:   "prune",
+		Short: "Removes the least recently used files from the cache.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.CacheDir == "" {
+				return exit.Usage(errors.New("--cache-dir is required"))
+			}
+			var maxBytes int64
+			if options.MaxSize != "" {
+				size, err := resource.ParseQuantity(options.MaxSize)
+				if err != nil {
+					return exit.Usage(fmt.Errorf("invalid --max-size %q: %w", options.MaxSize, err))
+				}
+				maxBytes = size.Value()
+			}
+			removed, err := prow.NewCache(options.CacheDir).Prune(options.MaxAge, maxBytes)
+			if err != nil {
+				return err
+			}
+			return printStats(removed)
+		},
+	}
+
+	command.Flags().StringVarP(&options.CacheDir, "cache-dir", "", "", "cache directory")
+	command.Flags().DurationVarP(&options.MaxAge, "max-age", "", 0, "remove files not used for this long, or 0 for no limit")
+	command.Flags().StringVarP(&options.MaxSize, "max-size", "", "", "remove the least recently used files until the cache is no larger than this, like 10Gi")
+
+	return command
+}
+
+func printStats(stats prow.CacheStats) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "OBJECTS\tBYTES\tOLDEST\tNEWEST\n")
+	fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", stats.Objects, stats.Bytes, formatTime(stats.Oldest), formatTime(stats.Newest))
+	return w.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
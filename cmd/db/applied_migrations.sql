@@ -0,0 +1,2 @@
+select version, applied
+from schema_migrations;
\ No newline at end of file
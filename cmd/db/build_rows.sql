@@ -0,0 +1,5 @@
+select id
+from jobs
+where name = $name
+and build_id = $build_id
+and id != $id;
\ No newline at end of file
@@ -0,0 +1,2 @@
+delete from pulls
+where job_id = $job_id;
\ No newline at end of file
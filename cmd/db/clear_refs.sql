@@ -0,0 +1,2 @@
+delete from refs
+where job_id = $job_id;
\ No newline at end of file
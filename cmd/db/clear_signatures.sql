@@ -0,0 +1,2 @@
+delete from build_signatures
+where job_id = $job_id;
\ No newline at end of file
@@ -0,0 +1,2 @@
+delete from steps
+where job_id = $job_id;
\ No newline at end of file
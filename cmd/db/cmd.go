@@ -11,6 +11,11 @@ func NewCommand() *cobra.Command {
 	}
 
 	command.AddCommand(newCreateDBCommand())
+	command.AddCommand(newErrorsCommand())
+	command.AddCommand(newMigrateCommand())
+	command.AddCommand(newMergeCommand())
+	command.AddCommand(newPruneCommand())
+	command.AddCommand(newExportCommand())
 
 	return command
 }
@@ -4,29 +4,48 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"fmt"
 	"log"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/ironcladlou/prowdb/cmd/exit"
 	"github.com/ironcladlou/prowdb/prow"
 
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 )
 
-//go:embed create.sql
-var createQuery string
-
 //go:embed update.sql
 var updateQuery string
 
+//go:embed latest.sql
+var latestQuery string
+
+//go:embed pending.sql
+var pendingQuery string
+
+//go:embed build_rows.sql
+var buildRowsQuery string
+
+//go:embed job_exists.sql
+var jobExistsQuery string
+
+// StartedLayout is how build start times are stored in the started column of
+// the jobs table.
+const StartedLayout = "2006-01-02 15:04:05 -0700 MST"
+
 type createDbOptions struct {
-	BaseURL    string
-	From       time.Duration
-	Jobs       []string
-	OutputFile string
-	DryRun     bool
+	ingestOptions
+	prow.JobSelector
+	OutputFile  string
+	DryRun      bool
+	Incremental bool
 }
 
 func newCreateDBCommand() *cobra.Command {
@@ -35,62 +54,365 @@ func newCreateDBCommand() *cobra.Command {
 	var command = &cobra.Command{
 		Use:   "create",
 		Short: "Creates or updates a sqlite database with CI build history.",
-		Run: func(cmd *cobra.Command, args []string) {
-			err := create(context.TODO(), options)
-			if err != nil {
-				panic(err)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := options.Complete(cmd.Flags()); err != nil {
+				return err
+			}
+			if err := options.SourceOptions.Validate(); err != nil {
+				return exit.Usage(err)
 			}
+			if err := options.JobSelector.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			return create(cmd.Context(), options)
 		},
 	}
 
-	command.Flags().StringVarP(&options.BaseURL, "base-url", "", prow.DefaultBaseURL, "")
-	command.Flags().DurationVarP(&options.From, "from", "", 24*time.Hour, "how far back to find builds")
-	command.Flags().StringArrayVarP(&options.Jobs, "job", "", []string{"pull-ci-openshift-hypershift-main-e2e-aws"}, "jobs to find")
+	options.ingestOptions.AddFlags(command.Flags())
+	options.JobSelector.AddFlags(command.Flags())
 	command.Flags().StringVarP(&options.OutputFile, "output-file", "f", "prow.db", "output database file location")
 	command.Flags().BoolVarP(&options.DryRun, "dry-run", "", false, "output data and exit without writing")
+	command.Flags().BoolVarP(&options.Incremental, "incremental", "", false, "resume each job from the newest build already in the database and refresh pending builds")
 
 	return command
 }
 
 func create(ctx context.Context, opts createDbOptions) error {
-	conn, err := sqlite.OpenConn(opts.OutputFile, sqlite.OpenReadWrite, sqlite.OpenCreate)
+	conn, err := Open(ctx, opts.OutputFile)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	// Create the jobs table
-	err = sqlitex.ExecuteTransient(conn, createQuery, &sqlitex.ExecOptions{})
+	jobs, err := prow.SelectJobs(ctx, &opts.SourceOptions, opts.JobSelector)
 	if err != nil {
 		return err
 	}
 
-	builds, err := prow.GetJobHistoryByJobName(ctx, opts.BaseURL, opts.From, opts.Jobs...)
-	if err != nil {
+	var pending map[string][]int64
+	if opts.Incremental {
+		opts.Since, pending, err = readSyncState(conn, jobs)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ingest(ctx, conn, opts.ingestOptions, jobs, pending)
+}
+
+// ingest fetches the history of jobs and the builds of each job listed in
+// ids, then stores the builds found along with the jobs and builds that
+// couldn't be read.
+func ingest(ctx context.Context, conn *sqlite.Conn, opts ingestOptions, jobs []string, ids map[string][]int64) error {
+	if err := opts.loadSignatures(); err != nil {
 		return err
 	}
 
+	// Failed jobs are reported after the builds that were found are written
+	var builds []prow.Build
+	var fetchErr error
+	if len(jobs) > 0 {
+		builds, fetchErr = prow.GetJobHistoryByJobName(ctx, opts.HistoryOptions, jobs...)
+	}
+	for _, job := range sortedKeys(ids) {
+		log.Printf("refreshing %d builds for job %s", len(ids[job]), job)
+		refreshed, err := prow.GetJobBuildsByID(ctx, opts.HistoryOptions, job, ids[job]...)
+		if err != nil {
+			fetchErr = utilerrors.NewAggregate([]error{fetchErr, err})
+		}
+		builds = append(builds, refreshed...)
+	}
+
 	log.Printf("found %d builds", len(builds))
 
-	for _, build := range builds {
-		prowJson, err := json.MarshalIndent(build.ProwJob, "", "  ")
+	details, err := fetchDetails(ctx, opts, builds)
+	if err != nil {
+		fetchErr = utilerrors.NewAggregate([]error{fetchErr, err})
+	}
+
+	// A history cut short may have gaps, which an incremental run would
+	// never go back to fill, so nothing is written.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	failures := prow.Failures(fetchErr)
+	storeStarted := time.Now()
+	if err := store(conn, opts, jobs, builds, details, failures); err != nil {
+		return err
+	}
+
+	log.Printf("wrote %d records and %d ingest errors in %v", len(builds), len(failures), time.Since(storeStarted))
+	if len(builds) > 0 {
+		return exit.Partial(fetchErr)
+	}
+	return fetchErr
+}
+
+// jobBatch is what's stored for one job.
+type jobBatch struct {
+	job string
+	// selected is set for jobs whose history was fetched as a whole, which
+	// clears the failures previously recorded for the job as a whole.
+	selected bool
+	builds   []prow.Build
+	details  []*buildDetails
+	failures []prow.Failure
+}
+
+// batchByJob groups builds, their details and failures by job, in the order
+// each job first appears.
+func batchByJob(jobs []string, builds []prow.Build, details []*buildDetails, failures []prow.Failure) []*jobBatch {
+	var batches []*jobBatch
+	byJob := map[string]*jobBatch{}
+	batch := func(job string) *jobBatch {
+		b, ok := byJob[job]
+		if !ok {
+			b = &jobBatch{job: job}
+			byJob[job] = b
+			batches = append(batches, b)
+		}
+		return b
+	}
+	for _, job := range jobs {
+		batch(job).selected = true
+	}
+	for i, build := range builds {
+		b := batch(build.Job)
+		b.builds = append(b.builds, build)
+		b.details = append(b.details, details[i])
+	}
+	for _, failure := range failures {
+		b := batch(failure.Job)
+		b.failures = append(b.failures, failure)
+	}
+	return batches
+}
+
+// store writes builds and failures in a savepoint per job, so each job is
+// either written in full or not at all. Failures previously recorded for the
+// builds, and for the selected jobs as a whole, are cleared.
+func store(conn *sqlite.Conn, opts ingestOptions, jobs []string, builds []prow.Build, details []*buildDetails, failures []prow.Failure) error {
+	recorded := time.Now()
+	for _, batch := range batchByJob(jobs, builds, details, failures) {
+		if err := storeJob(conn, opts, batch, recorded); err != nil {
+			return fmt.Errorf("storing job %s: %w", batch.job, err)
+		}
+	}
+	return nil
+}
+
+func storeJob(conn *sqlite.Conn, opts ingestOptions, batch *jobBatch, recorded time.Time) (err error) {
+	defer sqlitex.Save(conn)(&err)
+
+	if err := writeBuilds(conn, opts, batch.builds, batch.details); err != nil {
+		return err
+	}
+	if batch.selected {
+		if err := resolveError(conn, batch.job, ""); err != nil {
+			return err
+		}
+	}
+	return recordErrors(conn, batch.failures, recorded)
+}
+
+func writeBuilds(conn *sqlite.Conn, opts ingestOptions, builds []prow.Build, details []*buildDetails) error {
+	for i, build := range builds {
+		id, err := rowID(conn, build)
 		if err != nil {
 			return err
 		}
-		err = sqlitex.ExecuteTransient(conn, updateQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
-			"$id":       build.ProwJob.Name,
+		var prowJson interface{}
+		if build.ProwJob.Name != "" {
+			prowJson, err = json.MarshalIndent(build.ProwJob, "", "  ")
+			if err != nil {
+				return err
+			}
+		}
+		err = sqlitex.Execute(conn, updateQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+			"$id":       id,
 			"$name":     build.Job,
 			"$result":   strings.ToLower(build.Result),
 			"$started":  build.Started,
 			"$duration": build.Duration,
 			"$url":      build.URL,
 			"$prowjob":  prowJson,
+			"$build_id": build.ID,
+
+			"$commit_hash":       nullIfEmpty(build.CommitHash),
+			"$repos":             jsonOrNull(build.Repos),
+			"$repo_commit":       nullIfEmpty(build.RepoCommit),
+			"$started_metadata":  jsonOrNull(build.StartedMetadata),
+			"$finished_metadata": jsonOrNull(build.FinishedMetadata),
+
+			"$created":         timeOrNull(&build.ProwJob.CreationTimestamp),
+			"$start_time":      timeOrNull(&build.ProwJob.Status.StartTime),
+			"$pending_time":    timeOrNull(build.ProwJob.Status.PendingTime),
+			"$completion_time": timeOrNull(build.ProwJob.Status.CompletionTime),
+			"$state":           nullIfEmpty(string(build.ProwJob.Status.State)),
+			"$pod_name":        nullIfEmpty(build.ProwJob.Status.PodName),
+			"$cluster":         nullIfEmpty(build.ProwJob.Spec.Cluster),
 		}})
 		if err != nil {
 			return err
 		}
+		if build.ProwJob.Name != "" {
+			if err := writeRefs(conn, id, build); err != nil {
+				return err
+			}
+		}
+		if err := writeDetails(conn, opts, id, build, details[i]); err != nil {
+			return err
+		}
+		if err := resolveError(conn, build.Job, build.ID); err != nil {
+			return err
+		}
 	}
-
-	log.Printf("wrote %d records to %s", len(builds), opts.OutputFile)
 	return nil
 }
+
+// rowID returns the id of the jobs row of a build, which is the name of its
+// ProwJob. A build whose prowjob.json couldn't be read keeps the row it was
+// stored in before, or is stored as <job>/<build ID> until its ProwJob is
+// read, when the row and its details move to the ProwJob's name.
+func rowID(conn *sqlite.Conn, build prow.Build) (string, error) {
+	var existing []string
+	err := sqlitex.Execute(conn, buildRowsQuery, &sqlitex.ExecOptions{
+		Named: map[string]interface{}{
+			"$name":     build.Job,
+			"$build_id": build.ID,
+			"$id":       build.ProwJob.Name,
+		},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			existing = append(existing, stmt.ColumnText(0))
+			return nil
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if build.ProwJob.Name == "" {
+		if len(existing) > 0 {
+			return existing[0], nil
+		}
+		return build.Job + "/" + build.ID, nil
+	}
+	for _, from := range existing {
+		if err := moveRow(conn, from, build.ProwJob.Name); err != nil {
+			return "", err
+		}
+	}
+	return build.ProwJob.Name, nil
+}
+
+// buildTables are the tables holding rows for each row of jobs.
+var buildTables = []string{"test_cases", "build_signatures", "steps", "refs", "pulls", "artifacts", "revisions"}
+
+// moveRow moves a jobs row and the rows of each build table for it to a new
+// id. If a row with the new id already exists, the old rows are deleted
+// instead.
+func moveRow(conn *sqlite.Conn, from, to string) error {
+	var exists bool
+	err := sqlitex.Execute(conn, jobExistsQuery, &sqlitex.ExecOptions{
+		Named: map[string]interface{}{"$id": to},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			exists = stmt.ColumnInt(0) > 0
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	move := func(table, column string) error {
+		query := fmt.Sprintf("update %s set %s = $to where %s = $from", table, column, column)
+		args := map[string]interface{}{"$from": from, "$to": to}
+		if exists {
+			query = fmt.Sprintf("delete from %s where %s = $from", table, column)
+			args = map[string]interface{}{"$from": from}
+		}
+		return sqlitex.Execute(conn, query, &sqlitex.ExecOptions{Named: args})
+	}
+	for _, table := range buildTables {
+		if err := move(table, "job_id"); err != nil {
+			return err
+		}
+	}
+	return move("jobs", "id")
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// timeOrNull formats a ProwJob timestamp like the ProwJob does, or returns
+// NULL if it isn't set.
+func timeOrNull(t *metav1.Time) interface{} {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// jsonOrNull encodes a map as a JSON object, or NULL if it's empty.
+func jsonOrNull(m interface{}) interface{} {
+	if reflect.ValueOf(m).Len() == 0 {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
+func sortedKeys(m map[string][]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readSyncState finds where each job's stored history ends. since maps jobs
+// with stored builds to their newest build ID, and pending lists the builds
+// of each job that hadn't finished when they were stored.
+func readSyncState(conn *sqlite.Conn, jobs []string) (since map[string]int64, pending map[string][]int64, err error) {
+	since = map[string]int64{}
+	pending = map[string][]int64{}
+	for _, job := range jobs {
+		err := sqlitex.ExecuteTransient(conn, latestQuery, &sqlitex.ExecOptions{
+			Named: map[string]interface{}{"$name": job},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				if stmt.ColumnType(0) == sqlite.TypeNull {
+					return nil
+				}
+				since[job] = stmt.ColumnInt64(0)
+				started, err := time.Parse(StartedLayout, stmt.ColumnText(1))
+				if err != nil {
+					log.Printf("resuming job %s after build %d", job, since[job])
+				} else {
+					log.Printf("resuming job %s after build %d started %s", job, since[job], started.UTC().Format(time.RFC3339))
+				}
+				return nil
+			},
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading newest build of job %s: %w", job, err)
+		}
+		err = sqlitex.ExecuteTransient(conn, pendingQuery, &sqlitex.ExecOptions{
+			Named: map[string]interface{}{"$name": job},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				pending[job] = append(pending[job], stmt.ColumnInt64(0))
+				return nil
+			},
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading pending builds of job %s: %w", job, err)
+		}
+	}
+	return since, pending, nil
+}
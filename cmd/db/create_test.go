@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ironcladlou/prowdb/prow"
+	v1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"zombiezen.com/go/sqlite"
+)
+
+// syntheticBuilds returns n builds spread over jobs jobs, with a ProwJob
+// each.
+func syntheticBuilds(jobs, n int) ([]string, []prow.Build) {
+	var names []string
+	for j := 0; j < jobs; j++ {
+		names = append(names, fmt.Sprintf("periodic-bench-%d", j))
+	}
+	started := time.Now().Add(-time.Duration(n) * time.Minute)
+	builds := make([]prow.Build, n)
+	for i := range builds {
+		b := &builds[i]
+		b.Job = names[i%jobs]
+		b.ID = fmt.Sprint(1000 + i)
+		b.URL = "https://prow.example.com/view/gs/bucket/logs/" + b.Job + "/" + b.ID
+		b.Result = "SUCCESS"
+		b.Started = started.Add(time.Duration(i) * time.Minute)
+		b.Duration = 30 * time.Minute
+		b.ProwJob.Name = fmt.Sprintf("prowjob-%d", i)
+		b.ProwJob.Spec.Job = b.Job
+		b.ProwJob.Spec.Cluster = "build01"
+		b.ProwJob.Status.State = v1.SuccessState
+	}
+	return names, builds
+}
+
+func BenchmarkStore(b *testing.B) {
+	const (
+		jobs   = 10
+		builds = 10000
+	)
+	names, all := syntheticBuilds(jobs, builds)
+	details := make([]*buildDetails, len(all))
+	// Open logs each migration it applies to the new databases.
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, bench := range []struct {
+		name  string
+		store func(conn *sqlite.Conn) error
+	}{
+		{
+			name: "transaction per job",
+			store: func(conn *sqlite.Conn) error {
+				return store(conn, ingestOptions{}, names, all, details, nil)
+			},
+		},
+		{
+			// Each statement commits on its own, as builds were written
+			// before jobs were stored in a transaction.
+			name: "no transaction",
+			store: func(conn *sqlite.Conn) error {
+				for i := range all {
+					if err := writeBuilds(conn, ingestOptions{}, all[i:i+1], details[i:i+1]); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				conn, err := Open(context.Background(), filepath.Join(b.TempDir(), "prow.db"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if err := bench.store(conn); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				conn.Close()
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"sync"
+
+	"github.com/ironcladlou/prowdb/prow"
+
+	"github.com/spf13/pflag"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+//go:embed insert_test_case.sql
+var insertTestCaseQuery string
+
+//go:embed clear_test_cases.sql
+var clearTestCasesQuery string
+
+//go:embed insert_signature.sql
+var insertSignatureQuery string
+
+//go:embed clear_signatures.sql
+var clearSignaturesQuery string
+
+//go:embed insert_step.sql
+var insertStepQuery string
+
+//go:embed clear_steps.sql
+var clearStepsQuery string
+
+//go:embed insert_artifact.sql
+var insertArtifactQuery string
+
+//go:embed clear_artifacts.sql
+var clearArtifactsQuery string
+
+// ingestOptions control what is fetched and stored for each build.
+type ingestOptions struct {
+	prow.HistoryOptions
+	// JUnit enables storing the test cases of each build's JUnit reports.
+	JUnit bool
+	// Steps enables storing the steps of each build's ci-operator step graph.
+	Steps bool
+	// Artifacts enables storing the name and size of every file each build
+	// uploaded.
+	Artifacts bool
+	// SignaturesFile names a signatures file to scan build logs with.
+	SignaturesFile string
+
+	signatures *prow.Signatures
+}
+
+func (o *ingestOptions) AddFlags(flags *pflag.FlagSet) {
+	o.HistoryOptions.AddFlags(flags)
+	flags.BoolVarP(&o.JUnit, "junit", "", false, "store test cases from the junit*.xml files under each build's artifacts/")
+	flags.BoolVarP(&o.Steps, "steps", "", false, "store the steps of each build's "+prow.StepGraph)
+	flags.BoolVarP(&o.Artifacts, "artifacts", "", false, "store the name and size of every file each build uploaded")
+	flags.StringVarP(&o.SignaturesFile, "signatures", "", "", "YAML file of failure signatures to look for in each build's build-log.txt")
+}
+
+// loadSignatures reads the signatures file, if any.
+func (o *ingestOptions) loadSignatures() error {
+	if o.SignaturesFile == "" {
+		return nil
+	}
+	sigs, err := prow.LoadSignatures(o.SignaturesFile)
+	if err != nil {
+		return err
+	}
+	o.signatures = sigs
+	return nil
+}
+
+func (o *ingestOptions) wantsDetails() bool {
+	return o.JUnit || o.Steps || o.Artifacts || o.signatures != nil
+}
+
+// buildDetails are read from a build's artifacts.
+type buildDetails struct {
+	TestCases  []prow.TestCase
+	Signatures []prow.SignatureMatch
+	Steps      []prow.Step
+	Artifacts  []prow.Artifact
+}
+
+// fetchDetails reads the details of each build, using at most
+// opts.BuildConcurrency builds at a time. Details are nil for builds whose
+// artifacts couldn't be read, and for every build if none are wanted.
+func fetchDetails(ctx context.Context, opts ingestOptions, builds []prow.Build) ([]*buildDetails, error) {
+	details := make([]*buildDetails, len(builds))
+	if !opts.wantsDetails() || len(builds) == 0 {
+		return details, nil
+	}
+	artifacts, err := prow.OpenArtifacts(ctx, opts.Storage)
+	if err != nil {
+		return details, err
+	}
+
+	concurrency := opts.BuildConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := make([]error, len(builds))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				details[i], errs[i] = fetchBuildDetails(ctx, opts, artifacts, builds[i])
+			}
+		}()
+	}
+	for i := range builds {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return details, utilerrors.NewAggregate(errs)
+}
+
+func fetchBuildDetails(ctx context.Context, opts ingestOptions, artifacts *prow.Artifacts, build prow.Build) (*buildDetails, error) {
+	var details buildDetails
+	if opts.JUnit {
+		cases, err := prow.GetTestCases(ctx, artifacts, build)
+		if err != nil {
+			return nil, err
+		}
+		details.TestCases = cases
+	}
+	if opts.signatures != nil {
+		matches, err := prow.ScanBuildLog(ctx, artifacts, build, opts.signatures)
+		if err != nil {
+			return nil, err
+		}
+		details.Signatures = matches
+	}
+	if opts.Steps {
+		steps, err := prow.GetSteps(ctx, artifacts, build)
+		if err != nil {
+			return nil, err
+		}
+		details.Steps = steps
+	}
+	if opts.Artifacts {
+		inventory, err := artifacts.Inventory(ctx, build)
+		if err != nil {
+			return nil, err
+		}
+		details.Artifacts = inventory
+	}
+	return &details, nil
+}
+
+// writeDetails replaces the stored details of a build.
+func writeDetails(conn *sqlite.Conn, opts ingestOptions, jobID string, build prow.Build, details *buildDetails) error {
+	if details == nil {
+		return nil
+	}
+	if opts.JUnit {
+		err := sqlitex.Execute(conn, clearTestCasesQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+			"$job_id": jobID,
+		}})
+		if err != nil {
+			return err
+		}
+		for _, c := range details.TestCases {
+			err := sqlitex.Execute(conn, insertTestCaseQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+				"$job_id":   jobID,
+				"$build_id": build.ID,
+				"$suite":    c.Suite,
+				"$name":     c.Name,
+				"$status":   c.Status,
+				"$duration": c.Duration,
+				"$message":  c.Message,
+			}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if opts.signatures != nil {
+		err := sqlitex.Execute(conn, clearSignaturesQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+			"$job_id": jobID,
+		}})
+		if err != nil {
+			return err
+		}
+		for _, match := range details.Signatures {
+			err := sqlitex.Execute(conn, insertSignatureQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+				"$job_id":    jobID,
+				"$build_id":  build.ID,
+				"$signature": match.Name,
+				"$line":      match.Line,
+				"$text":      match.Text,
+			}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if opts.Steps {
+		err := sqlitex.Execute(conn, clearStepsQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+			"$job_id": jobID,
+		}})
+		if err != nil {
+			return err
+		}
+		for _, step := range details.Steps {
+			var started, parent interface{}
+			if !step.Started.IsZero() {
+				started = step.Started
+			}
+			if step.Parent != "" {
+				parent = step.Parent
+			}
+			dependencies := []string{}
+			dependencies = append(dependencies, step.Dependencies...)
+			dependenciesJson, err := json.Marshal(dependencies)
+			if err != nil {
+				return err
+			}
+			err = sqlitex.Execute(conn, insertStepQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+				"$job_id":       jobID,
+				"$build_id":     build.ID,
+				"$name":         step.Name,
+				"$parent":       parent,
+				"$started":      started,
+				"$duration":     step.Duration,
+				"$result":       step.Result,
+				"$dependencies": string(dependenciesJson),
+			}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if opts.Artifacts {
+		err := sqlitex.Execute(conn, clearArtifactsQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+			"$job_id": jobID,
+		}})
+		if err != nil {
+			return err
+		}
+		for _, artifact := range details.Artifacts {
+			err := sqlitex.Execute(conn, insertArtifactQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+				"$job_id":           jobID,
+				"$build_id":         build.ID,
+				"$name":             artifact.Name,
+				"$size":             artifact.Size,
+				"$content_type":     nullIfEmpty(artifact.ContentType),
+				"$content_encoding": nullIfEmpty(artifact.ContentEncoding),
+			}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
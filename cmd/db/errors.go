@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ironcladlou/prowdb/cmd/exit"
+	"github.com/ironcladlou/prowdb/prow"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+//go:embed record_error.sql
+var recordErrorQuery string
+
+//go:embed resolve_error.sql
+var resolveErrorQuery string
+
+//go:embed errors.sql
+var errorsQuery string
+
+// ingestError is a row of the ingest_errors table.
+type ingestError struct {
+	Job string
+	// BuildID is empty for failures of the job as a whole.
+	BuildID  string
+	Key      string
+	Class    string
+	Error    string
+	Recorded string
+}
+
+// errorFilter selects rows of the ingest_errors table.
+type errorFilter struct {
+	Job   string
+	Class string
+}
+
+func (f *errorFilter) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&f.Job, "job", "", "", "only errors of this job")
+	flags.StringVarP(&f.Class, "class", "", "", "only errors of this class: not-found, permission-denied, transient or permanent")
+}
+
+// Validate reports a --class that isn't an error class.
+func (f errorFilter) Validate() error {
+	switch prow.ErrorClass(f.Class) {
+	case "", prow.ErrorNotFound, prow.ErrorPermissionDenied, prow.ErrorTransient, prow.ErrorPermanent:
+		return nil
+	}
+	return fmt.Errorf("invalid --class %q: must be not-found, permission-denied, transient or permanent", f.Class)
+}
+
+func newErrorsCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "errors",
+		Short: "Lists and retries jobs and builds that couldn't be ingested.",
+	}
+
+	command.AddCommand(newErrorsListCommand())
+	command.AddCommand(newErrorsRetryCommand())
+
+	return command
+}
+
+type errorsListOptions struct {
+	errorFilter
+	OutputFile string
+}
+
+func newErrorsListCommand() *cobra.Command {
+	var options errorsListOptions
+
+	var command = &cobra.Command{
+		Use:   "list",
+		Short: "Lists recorded ingest errors.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := options.errorFilter.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			return listErrors(cmd.Context(), options)
+		},
+	}
+
+	options.errorFilter.AddFlags(command.Flags())
+	command.Flags().StringVarP(&options.OutputFile, "output-file", "f", "prow.db", "database file location")
+
+	return command
+}
+
+func listErrors(ctx context.Context, opts errorsListOptions) error {
+	if _, err := os.Stat(opts.OutputFile); err != nil {
+		return err
+	}
+	conn, err := OpenReadOnly(ctx, opts.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := readErrors(conn, opts.errorFilter)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tBUILD\tCLASS\tRECORDED\tKEY\tERROR")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", row.Job, row.BuildID, row.Class, row.Recorded, row.Key, row.Error)
+	}
+	return w.Flush()
+}
+
+type errorsRetryOptions struct {
+	ingestOptions
+	errorFilter
+	OutputFile string
+}
+
+func newErrorsRetryCommand() *cobra.Command {
+	var options errorsRetryOptions
+
+	var command = &cobra.Command{
+		Use:   "retry",
+		Short: "Fetches the jobs and builds with recorded ingest errors again.",
+		Long: `Fetches the jobs and builds with recorded ingest errors again. Failed builds
+are fetched by ID. Jobs that failed as a whole are fetched back to the newest
+build already stored, or back --from if none is.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := options.Complete(cmd.Flags()); err != nil {
+				return err
+			}
+			if err := options.SourceOptions.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			if err := options.errorFilter.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			return retryErrors(cmd.Context(), options)
+		},
+	}
+
+	options.ingestOptions.AddFlags(command.Flags())
+	options.errorFilter.AddFlags(command.Flags())
+	command.Flags().StringVarP(&options.OutputFile, "output-file", "f", "prow.db", "database file location")
+
+	return command
+}
+
+func retryErrors(ctx context.Context, opts errorsRetryOptions) error {
+	conn, err := Open(ctx, opts.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := readErrors(conn, opts.errorFilter)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(os.Stderr, "no ingest errors to retry")
+		return nil
+	}
+
+	var jobs []string
+	ids := map[string][]int64{}
+	for _, row := range rows {
+		if row.BuildID == "" {
+			jobs = append(jobs, row.Job)
+			continue
+		}
+		id, err := strconv.ParseInt(row.BuildID, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid build ID %q of job %s: %w", row.BuildID, row.Job, err)
+		}
+		ids[row.Job] = append(ids[row.Job], id)
+	}
+
+	opts.Since, _, err = readSyncState(conn, jobs)
+	if err != nil {
+		return err
+	}
+	return ingest(ctx, conn, opts.ingestOptions, jobs, ids)
+}
+
+func readErrors(conn *sqlite.Conn, filter errorFilter) ([]ingestError, error) {
+	var rows []ingestError
+	err := sqlitex.ExecuteTransient(conn, errorsQuery, &sqlitex.ExecOptions{
+		Named: map[string]interface{}{
+			"$job":   filter.Job,
+			"$class": filter.Class,
+		},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			rows = append(rows, ingestError{
+				Job:      stmt.ColumnText(0),
+				BuildID:  stmt.ColumnText(1),
+				Key:      stmt.ColumnText(2),
+				Class:    stmt.ColumnText(3),
+				Error:    stmt.ColumnText(4),
+				Recorded: stmt.ColumnText(5),
+			})
+			return nil
+		},
+	})
+	return rows, err
+}
+
+func recordErrors(conn *sqlite.Conn, failures []prow.Failure, recorded time.Time) error {
+	for _, failure := range failures {
+		buildID := ""
+		if failure.BuildID != 0 {
+			buildID = strconv.FormatInt(failure.BuildID, 10)
+		}
+		err := sqlitex.Execute(conn, recordErrorQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+			"$job":      failure.Job,
+			"$build_id": buildID,
+			"$key":      failure.Key,
+			"$class":    string(failure.Class),
+			"$error":    failure.Err.Error(),
+			"$recorded": recorded.UTC().Format(time.RFC3339),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveError clears the recorded failure of a build, or of the job as a
+// whole if buildID is empty.
+func resolveError(conn *sqlite.Conn, job, buildID string) error {
+	return sqlitex.Execute(conn, resolveErrorQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+		"$job":      job,
+		"$build_id": buildID,
+	}})
+}
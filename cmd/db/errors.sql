@@ -0,0 +1,5 @@
+select job, build_id, key, class, error, recorded
+from ingest_errors
+where ($job = '' or job = $job)
+and ($class = '' or class = $class)
+order by job, cast(build_id as integer) desc;
\ No newline at end of file
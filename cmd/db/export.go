@@ -0,0 +1,401 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ironcladlou/prowdb/cmd/exit"
+
+	"github.com/spf13/cobra"
+	"github.com/xitongsys/parquet-go/writer"
+	"zombiezen.com/go/sqlite"
+)
+
+// parquetRowGroupSize bounds how much of a Parquet export is held in memory
+// before it's written.
+const parquetRowGroupSize = 16 * 1024 * 1024
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// nonIdentifier matches the characters replaced to make a column name from a
+// JSON path, or a Parquet field name from a column name.
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+type exportOptions struct {
+	OutputFile string
+	Format     string
+	Query      string
+	Out        string
+	// ProwJobPaths are the JSON paths of the ProwJob to add as columns,
+	// keyed by column name.
+	ProwJobPaths []string
+}
+
+func newExportCommand() *cobra.Command {
+	var options exportOptions
+
+	var command = &cobra.Command{
+		Use:   "export",
+		Short: "Exports a table or query result as CSV, JSON Lines or Parquet.",
+		Long: `Exports a table or query result as CSV, JSON Lines or Parquet.
+
+--query is a table name or a SQL query. The database is only read, so it's
+exported as it is, without pending migrations. Rows are streamed to the output
+as they're read. --prowjob-path adds a column holding the value at a JSON path of
+each build's ProwJob, given as <column>=<path> or just <path>, like
+spec.cluster or $.status.state. The ProwJob is looked up by the id of jobs or
+the job_id column the query selects, so the query needn't select the prowjob
+column. Its column can't be named like one the query selects. For example:
+
+  prowdb db export --format parquet --query jobs --prowjob-path agent=spec.agent -o jobs.parquet
+
+Parquet columns are typed by the declared type of the table column they come
+from: integers as INT64, reals as DOUBLE, and everything else, including
+computed columns, as UTF8 strings.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch options.Format {
+			case "csv", "jsonl", "parquet":
+			default:
+				return exit.Usage(fmt.Errorf("invalid --format %q: must be csv, jsonl or parquet", options.Format))
+			}
+			return exportDB(cmd.Context(), options)
+		},
+	}
+
+	command.Flags().StringVarP(&options.OutputFile, "output-file", "f", "prow.db", "database file location")
+	command.Flags().StringVarP(&options.Format, "format", "", "csv", "output format: csv, jsonl or parquet")
+	command.Flags().StringVarP(&options.Query, "query", "q", "jobs", "table name or SQL query to export")
+	command.Flags().StringVarP(&options.Out, "out", "o", "-", "file to write, or - for stdout")
+	command.Flags().StringArrayVarP(&options.ProwJobPaths, "prowjob-path", "", nil, "add a column from a JSON path of the ProwJob, as <column>=<path> or <path>")
+
+	return command
+}
+
+// quoteIdentifier quotes a table or column name for use in SQL.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// exportQuery returns the query selecting the exported rows. Columns from
+// the ProwJob are looked up by the job id the query selects, so the query
+// doesn't have to select the prowjob column itself. A ProwJob column can't
+// be named like another column, which CSV headers and JSON objects couldn't
+// tell apart.
+func exportQuery(conn *sqlite.Conn, opts exportOptions) (string, error) {
+	query := strings.TrimSuffix(strings.TrimSpace(opts.Query), ";")
+	if tableName.MatchString(query) {
+		query = "select * from " + quoteIdentifier(query)
+	}
+	if len(opts.ProwJobPaths) == 0 {
+		return query, nil
+	}
+	key, names, err := queryColumns(conn, query)
+	if err != nil {
+		return "", fmt.Errorf("invalid --query: %w", err)
+	}
+	columns := []string{"q.*"}
+	for _, p := range opts.ProwJobPaths {
+		column, jsonPath := "", p
+		if i := strings.Index(p, "="); i >= 0 {
+			column, jsonPath = p[:i], p[i+1:]
+		}
+		if !strings.HasPrefix(jsonPath, "$") {
+			jsonPath = "$." + jsonPath
+		}
+		if column == "" {
+			column = strings.Trim(nonIdentifier.ReplaceAllString(jsonPath, "_"), "_")
+		}
+		if names[strings.ToLower(column)] {
+			return "", fmt.Errorf("invalid --prowjob-path %q: there's already a column named %s; name the column with <column>=<path>", p, column)
+		}
+		names[strings.ToLower(column)] = true
+		columns = append(columns, fmt.Sprintf("json_extract(j.prowjob, '%s') as %s", strings.ReplaceAll(jsonPath, "'", "''"), quoteIdentifier(column)))
+	}
+	return fmt.Sprintf("select %s from (%s) q left join main.jobs j on j.id = q.%s", strings.Join(columns, ", "), query, quoteIdentifier(key)), nil
+}
+
+// queryColumns returns the column of query holding the id of a build's row in
+// jobs, which is the id column of jobs or a job_id column of the tables keyed
+// to it, and the lower case names of all its columns.
+func queryColumns(conn *sqlite.Conn, query string) (string, map[string]bool, error) {
+	stmt, _, err := conn.PrepareTransient(query)
+	if err != nil {
+		return "", nil, err
+	}
+	defer stmt.Finalize()
+	key := ""
+	names := map[string]bool{}
+	for i := 0; i < stmt.ColumnCount(); i++ {
+		name := stmt.ColumnName(i)
+		if key == "" && ((name == "id" && stmt.ColumnTableName(i) == "jobs") || name == "job_id") {
+			key = name
+		}
+		names[strings.ToLower(name)] = true
+	}
+	if key == "" {
+		return "", nil, errors.New("--prowjob-path requires the query to select the id of jobs or a job_id column")
+	}
+	return key, names, nil
+}
+
+// rowWriter writes the rows of a query in an export format.
+type rowWriter interface {
+	writeRow(stmt *sqlite.Stmt) error
+	close() error
+}
+
+func exportDB(ctx context.Context, opts exportOptions) (err error) {
+	if _, err := os.Stat(opts.OutputFile); err != nil {
+		return err
+	}
+	conn, err := OpenReadOnly(ctx, opts.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	query, err := exportQuery(conn, opts)
+	if err != nil {
+		return exit.Usage(err)
+	}
+	stmt, _, err := conn.PrepareTransient(query)
+	if err != nil {
+		return exit.Usage(fmt.Errorf("invalid --query: %w", err))
+	}
+	defer stmt.Finalize()
+
+	var out io.Writer = os.Stdout
+	if opts.Out != "-" {
+		f, err := os.Create(opts.Out)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		out = f
+	}
+	buffered := bufio.NewWriter(out)
+
+	var w rowWriter
+	switch opts.Format {
+	case "csv":
+		w, err = newCSVWriter(buffered, stmt)
+	case "jsonl":
+		w = &jsonlWriter{out: buffered}
+	case "parquet":
+		w, err = newParquetWriter(conn, buffered, stmt)
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		row, err := stmt.Step()
+		if err != nil {
+			return err
+		}
+		if !row {
+			break
+		}
+		if err := w.writeRow(stmt); err != nil {
+			return err
+		}
+	}
+	if err := w.close(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+type csvWriter struct {
+	out    *csv.Writer
+	record []string
+}
+
+func newCSVWriter(out io.Writer, stmt *sqlite.Stmt) (*csvWriter, error) {
+	w := &csvWriter{out: csv.NewWriter(out), record: make([]string, stmt.ColumnCount())}
+	for i := range w.record {
+		w.record[i] = stmt.ColumnName(i)
+	}
+	return w, w.out.Write(w.record)
+}
+
+// writeRow writes NULL as an empty field.
+func (w *csvWriter) writeRow(stmt *sqlite.Stmt) error {
+	for i := range w.record {
+		w.record[i] = stmt.ColumnText(i)
+	}
+	return w.out.Write(w.record)
+}
+
+func (w *csvWriter) close() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+type jsonlWriter struct {
+	out *bufio.Writer
+}
+
+// writeRow writes a row as an object with its columns in order. Blobs, like
+// the prowjob column, are written as strings.
+func (w *jsonlWriter) writeRow(stmt *sqlite.Stmt) error {
+	w.out.WriteByte('{')
+	for i := 0; i < stmt.ColumnCount(); i++ {
+		if i > 0 {
+			w.out.WriteByte(',')
+		}
+		key, err := json.Marshal(stmt.ColumnName(i))
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(columnValue(stmt, i))
+		if err != nil {
+			return err
+		}
+		w.out.Write(key)
+		w.out.WriteByte(':')
+		w.out.Write(value)
+	}
+	w.out.WriteByte('}')
+	return w.out.WriteByte('\n')
+}
+
+func (w *jsonlWriter) close() error {
+	return nil
+}
+
+func columnValue(stmt *sqlite.Stmt, i int) interface{} {
+	switch stmt.ColumnType(i) {
+	case sqlite.TypeNull:
+		return nil
+	case sqlite.TypeInteger:
+		return stmt.ColumnInt64(i)
+	case sqlite.TypeFloat:
+		return stmt.ColumnFloat(i)
+	default:
+		return stmt.ColumnText(i)
+	}
+}
+
+// Parquet physical types of exported columns.
+const (
+	parquetInt64  = "INT64"
+	parquetDouble = "DOUBLE"
+	parquetString = "UTF8"
+)
+
+type parquetWriter struct {
+	out    *writer.CSVWriter
+	types  []string
+	record []interface{}
+}
+
+func newParquetWriter(conn *sqlite.Conn, out io.Writer, stmt *sqlite.Stmt) (*parquetWriter, error) {
+	w := &parquetWriter{
+		types:  make([]string, stmt.ColumnCount()),
+		record: make([]interface{}, stmt.ColumnCount()),
+	}
+	declared := map[string]map[string]string{}
+	var schema []string
+	names := map[string]bool{}
+	for i := range w.types {
+		w.types[i] = parquetString
+		if table := stmt.ColumnTableName(i); table != "" {
+			if _, ok := declared[table]; !ok {
+				types, err := declaredTypes(conn, stmt.ColumnDatabaseName(i), table)
+				if err != nil {
+					return nil, err
+				}
+				declared[table] = types
+			}
+			w.types[i] = parquetType(declared[table][stmt.ColumnName(i)])
+		}
+		// Parquet field names can't hold the punctuation of computed
+		// column names, and must be unique.
+		name := nonIdentifier.ReplaceAllString(stmt.ColumnName(i), "_")
+		for names[strings.ToLower(name)] {
+			name += "_"
+		}
+		names[strings.ToLower(name)] = true
+		schema = append(schema, fmt.Sprintf("name=%s, type=%s, repetitiontype=OPTIONAL", name, w.types[i]))
+	}
+	var err error
+	w.out, err = writer.NewCSVWriterFromWriter(schema, out, 1)
+	if err != nil {
+		return nil, err
+	}
+	w.out.RowGroupSize = parquetRowGroupSize
+	return w, nil
+}
+
+// declaredTypes returns the declared type of each column of a table.
+func declaredTypes(conn *sqlite.Conn, schema, table string) (map[string]string, error) {
+	types := map[string]string{}
+	stmt, _, err := conn.PrepareTransient(fmt.Sprintf("select name, type from %s.pragma_table_info($table)", quoteIdentifier(schema)))
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Finalize()
+	stmt.SetText("$table", table)
+	for {
+		row, err := stmt.Step()
+		if err != nil {
+			return nil, err
+		}
+		if !row {
+			return types, nil
+		}
+		types[stmt.ColumnText(0)] = stmt.ColumnText(1)
+	}
+}
+
+// parquetType follows SQLite's rules for the affinity of a declared type,
+// with NUMERIC columns, like durations in nanoseconds, exported as integers.
+func parquetType(declared string) string {
+	declared = strings.ToUpper(declared)
+	switch {
+	case strings.Contains(declared, "INT"), strings.Contains(declared, "NUMERIC"):
+		return parquetInt64
+	case strings.Contains(declared, "CHAR"), strings.Contains(declared, "CLOB"), strings.Contains(declared, "TEXT"):
+		return parquetString
+	case strings.Contains(declared, "REAL"), strings.Contains(declared, "FLOA"), strings.Contains(declared, "DOUB"):
+		return parquetDouble
+	default:
+		return parquetString
+	}
+}
+
+func (w *parquetWriter) writeRow(stmt *sqlite.Stmt) error {
+	for i, t := range w.types {
+		if stmt.ColumnType(i) == sqlite.TypeNull {
+			w.record[i] = nil
+			continue
+		}
+		switch t {
+		case parquetInt64:
+			w.record[i] = stmt.ColumnInt64(i)
+		case parquetDouble:
+			w.record[i] = stmt.ColumnFloat(i)
+		default:
+			w.record[i] = stmt.ColumnText(i)
+		}
+	}
+	// The writer keeps the record until its row group is written.
+	return w.out.Write(append([]interface{}{}, w.record...))
+}
+
+func (w *parquetWriter) close() error {
+	return w.out.WriteStop()
+}
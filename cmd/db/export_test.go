@@ -0,0 +1,110 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestExportQueryProwJobPaths(t *testing.T) {
+	conn, err := Open(context.Background(), filepath.Join(t.TempDir(), "prow.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = sqlitex.Execute(conn, `insert into jobs (id, name, result, started, build_id, prowjob, cluster)
+values ('periodic-foo/1', 'periodic-foo', 'success', '2022-01-01T00:00:00Z', '1', '{"spec":{"agent":"kubernetes","cluster":"build01"}}', 'build01')`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		paths []string
+		// want are the names and values of the columns added, or the error.
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:  "named",
+			query: "jobs",
+			paths: []string{"agent=spec.agent"},
+			want:  map[string]string{"agent": "kubernetes"},
+		},
+		{
+			name:  "unnamed",
+			query: "jobs",
+			paths: []string{"spec.cluster"},
+			want:  map[string]string{"spec_cluster": "build01"},
+		},
+		{
+			name:  "not selected by the query",
+			query: "select id, name from jobs",
+			paths: []string{"cluster=spec.cluster"},
+			want:  map[string]string{"cluster": "build01"},
+		},
+		{
+			name:    "named like a column of the query",
+			query:   "jobs",
+			paths:   []string{"cluster=spec.cluster"},
+			wantErr: "already a column named cluster",
+		},
+		{
+			name:    "named like a column of the query in another case",
+			query:   "select id, result as State from jobs",
+			paths:   []string{"state=status.state"},
+			wantErr: "already a column named state",
+		},
+		{
+			name:    "named like another path",
+			query:   "select id from jobs",
+			paths:   []string{"agent=spec.agent", "agent=spec.type"},
+			wantErr: "already a column named agent",
+		},
+		{
+			name:    "no job id",
+			query:   "select name from jobs",
+			paths:   []string{"spec.agent"},
+			wantErr: "requires the query to select",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := exportQuery(conn, exportOptions{Query: tt.query, ProwJobPaths: tt.paths})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			err = sqlitex.ExecuteTransient(conn, query, &sqlitex.ExecOptions{
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					for i := stmt.ColumnCount() - len(tt.paths); i < stmt.ColumnCount(); i++ {
+						got[stmt.ColumnName(i)] = stmt.ColumnText(i)
+					}
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("added columns %v, want %v", got, tt.want)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("%s = %q, want %q", name, got[name], value)
+				}
+			}
+		})
+	}
+}
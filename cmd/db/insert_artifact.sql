@@ -0,0 +1,5 @@
+insert or replace into artifacts (
+  job_id, build_id, name, size, content_type, content_encoding
+) values (
+  $job_id, $build_id, $name, $size, $content_type, $content_encoding
+);
\ No newline at end of file
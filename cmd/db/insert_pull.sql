@@ -0,0 +1,5 @@
+insert or replace into pulls (
+  job_id, build_id, position, org, repo, number, author, sha, title
+) values (
+  $job_id, $build_id, $position, $org, $repo, $number, $author, $sha, $title
+);
\ No newline at end of file
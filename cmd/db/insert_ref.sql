@@ -0,0 +1,5 @@
+insert or replace into refs (
+  job_id, build_id, position, org, repo, base_ref, base_sha
+) values (
+  $job_id, $build_id, $position, $org, $repo, $base_ref, $base_sha
+);
\ No newline at end of file
@@ -0,0 +1,5 @@
+insert or replace into build_signatures (
+  job_id, build_id, signature, line, text
+) values (
+  $job_id, $build_id, $signature, $line, $text
+);
\ No newline at end of file
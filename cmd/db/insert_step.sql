@@ -0,0 +1,5 @@
+insert or replace into steps (
+  job_id, build_id, name, parent, started, duration, result, dependencies
+) values (
+  $job_id, $build_id, $name, $parent, $started, $duration, $result, $dependencies
+);
\ No newline at end of file
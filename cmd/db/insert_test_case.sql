@@ -0,0 +1,5 @@
+insert into test_cases (
+  job_id, build_id, suite, name, status, duration, message
+) values (
+  $job_id, $build_id, $suite, $name, $status, $duration, $message
+);
\ No newline at end of file
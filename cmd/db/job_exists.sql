@@ -0,0 +1,3 @@
+select count(*)
+from jobs
+where id = $id;
\ No newline at end of file
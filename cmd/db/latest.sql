@@ -0,0 +1,3 @@
+select max(cast(build_id as integer)), max(started)
+from jobs
+where name = $name;
\ No newline at end of file
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ironcladlou/prowdb/cmd/exit"
+
+	"github.com/spf13/cobra"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+//go:embed merge_tables.sql
+var mergeTablesQuery string
+
+//go:embed merge_moves.sql
+var mergeMovesQuery string
+
+//go:embed merge_rows.sql
+var mergeRowsQuery string
+
+type mergeOptions struct {
+	OutputFile string
+}
+
+func newMergeCommand() *cobra.Command {
+	var options mergeOptions
+
+	var command = &cobra.Command{
+		Use:   "merge SOURCE...",
+		Short: "Merges the builds of other databases into a database.",
+		Long: `Merges the builds of other databases into a database.
+
+Sources are merged one at a time, each in a single transaction. Sources are
+only read: each is copied to a temporary file, which is migrated to the
+current schema before it's merged. A build in a source replaces the stored
+build with the same id if the source's is fresher: it has a final result and
+the stored one doesn't, or else it completed later, or else it has a ProwJob
+and the stored one doesn't. A replaced build keeps the stored metadata and
+ProwJob where the source has none, and its details, like its test cases and
+steps, are replaced by the source's where the source has them.
+Recorded ingest errors are added for builds that aren't stored.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mergeDBs(cmd.Context(), options, args)
+		},
+	}
+
+	command.Flags().StringVarP(&options.OutputFile, "output-file", "f", "prow.db", "database file location")
+
+	return command
+}
+
+// merged counts what was done with the builds of a source.
+type merged struct {
+	source                     string
+	inserted, updated, skipped int64
+}
+
+func mergeDBs(ctx context.Context, opts mergeOptions, sources []string) error {
+	target, err := filepath.Abs(opts.OutputFile)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		if _, err := os.Stat(source); err != nil {
+			return exit.Usage(err)
+		}
+		if abs, err := filepath.Abs(source); err == nil && abs == target {
+			return exit.Usage(errors.New("a database can't be merged into itself"))
+		}
+	}
+
+	conn, err := Open(ctx, opts.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	dir, err := os.MkdirTemp("", "prowdb-merge-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var report []merged
+	for i, source := range sources {
+		// Migrating a copy of the source gives it the same tables and
+		// columns without writing to the source.
+		copied := filepath.Join(dir, fmt.Sprintf("%d.db", i))
+		if err := copyDB(ctx, source, copied); err != nil {
+			return fmt.Errorf("copying %s: %w", source, err)
+		}
+		if err := migrateCopy(ctx, copied); err != nil {
+			return fmt.Errorf("migrating %s: %w", source, err)
+		}
+
+		m, err := mergeSource(conn, copied)
+		if err != nil {
+			return fmt.Errorf("merging %s: %w", source, err)
+		}
+		m.source = source
+		report = append(report, m)
+		if err := os.Remove(copied); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "SOURCE\tINSERTED\tUPDATED\tSKIPPED\n")
+	for _, m := range report {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", m.source, m.inserted, m.updated, m.skipped)
+	}
+	return w.Flush()
+}
+
+// copyDB writes a consistent copy of the database in source to the new file
+// to, reading source without writing to it.
+func copyDB(ctx context.Context, source, to string) error {
+	conn, err := OpenReadOnly(ctx, source)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return sqlitex.ExecuteTransient(conn, "vacuum into $file", &sqlitex.ExecOptions{
+		Named: map[string]interface{}{"$file": to},
+	})
+}
+
+// migrateCopy applies all pending migrations to the copy of a source in file.
+func migrateCopy(ctx context.Context, file string) error {
+	conn, err := openConn(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = migrate(conn, 0)
+	return err
+}
+
+// mergeSource attaches a source database and merges it in a savepoint.
+// Databases can't be attached inside a transaction, so the savepoint is
+// opened once it's attached.
+func mergeSource(conn *sqlite.Conn, file string) (merged, error) {
+	err := sqlitex.ExecuteTransient(conn, "attach database $file as source", &sqlitex.ExecOptions{
+		Named: map[string]interface{}{"$file": file},
+	})
+	if err != nil {
+		return merged{}, err
+	}
+	m, err := mergeAttached(conn)
+	if detachErr := sqlitex.ExecuteTransient(conn, "detach database source", nil); err == nil {
+		err = detachErr
+	}
+	return m, err
+}
+
+// replacedJobColumns are taken from a fresher source build even where it has
+// no value. Like update.sql, every other column keeps its stored value where
+// the source's is null, such as a ProwJob dropped by db prune.
+var replacedJobColumns = map[string]bool{
+	"id":       true,
+	"name":     true,
+	"result":   true,
+	"started":  true,
+	"duration": true,
+	"url":      true,
+	"build_id": true,
+}
+
+func mergeAttached(conn *sqlite.Conn) (m merged, err error) {
+	defer sqlitex.Save(conn)(&err)
+
+	if err := sqlitex.ExecuteScript(conn, mergeTablesQuery, nil); err != nil {
+		return m, err
+	}
+	var moves [][2]string
+	err = sqlitex.ExecuteTransient(conn, mergeMovesQuery, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			moves = append(moves, [2]string{stmt.ColumnText(0), stmt.ColumnText(1)})
+			return nil
+		},
+	})
+	if err != nil {
+		return m, err
+	}
+	for _, move := range moves {
+		if err := moveRow(conn, move[0], move[1]); err != nil {
+			return m, err
+		}
+	}
+	if err := sqlitex.ExecuteTransient(conn, mergeRowsQuery, nil); err != nil {
+		return m, err
+	}
+	err = sqlitex.ExecuteTransient(conn, "select action, count(*) from temp.merge_rows group by action", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			switch stmt.ColumnText(0) {
+			case "insert":
+				m.inserted = stmt.ColumnInt64(1)
+			case "update":
+				m.updated = stmt.ColumnInt64(1)
+			case "skip":
+				m.skipped = stmt.ColumnInt64(1)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return m, err
+	}
+
+	// Updating rather than replacing rows records their revisions.
+	columns, err := tableColumns(conn, "jobs")
+	if err != nil {
+		return m, err
+	}
+	var set []string
+	for _, column := range columns {
+		if replacedJobColumns[column] {
+			set = append(set, fmt.Sprintf("%s = excluded.%s", column, column))
+		} else {
+			set = append(set, fmt.Sprintf("%s = coalesce(excluded.%s, jobs.%s)", column, column, column))
+		}
+	}
+	list := strings.Join(columns, ", ")
+	err = sqlitex.ExecuteTransient(conn, fmt.Sprintf(`insert into main.jobs (%s)
+select %s from source.jobs
+where id in (select id from temp.merge_rows where action != 'skip')
+on conflict (id) do update set %s`, list, list, strings.Join(set, ", ")), nil)
+	if err != nil {
+		return m, err
+	}
+
+	for _, table := range buildTables {
+		if table == "revisions" {
+			continue
+		}
+		columns, err := tableColumns(conn, table)
+		if err != nil {
+			return m, err
+		}
+		list := strings.Join(columns, ", ")
+		// Builds without rows in the source, such as those ingested with
+		// --junit=false, keep their stored rows.
+		replaced := fmt.Sprintf(`select distinct job_id from source.%s
+where job_id in (select id from temp.merge_rows where action != 'skip')`, table)
+		err = sqlitex.ExecuteTransient(conn, fmt.Sprintf("delete from main.%s where job_id in (%s)", table, replaced), nil)
+		if err != nil {
+			return m, err
+		}
+		err = sqlitex.ExecuteTransient(conn, fmt.Sprintf("insert into main.%s (%s) select %s from source.%s where job_id in (%s)", table, list, list, table, replaced), nil)
+		if err != nil {
+			return m, err
+		}
+	}
+
+	columns, err = tableColumns(conn, "ingest_errors")
+	if err != nil {
+		return m, err
+	}
+	list = strings.Join(columns, ", ")
+	err = sqlitex.ExecuteTransient(conn, fmt.Sprintf(`insert or ignore into main.ingest_errors (%s)
+select %s from source.ingest_errors e
+where not exists (
+  select 1 from main.jobs j where j.name = e.job and j.build_id = e.build_id
+)`, list, list), nil)
+	if err != nil {
+		return m, err
+	}
+	err = sqlitex.ExecuteTransient(conn, `delete from main.ingest_errors
+where exists (
+  select 1 from main.jobs j
+  where j.name = ingest_errors.job and j.build_id = ingest_errors.build_id
+  and j.id in (select id from temp.merge_rows where action != 'skip')
+)`, nil)
+	return m, err
+}
+
+// tableColumns returns the columns of a table in the main database.
+func tableColumns(conn *sqlite.Conn, table string) ([]string, error) {
+	var columns []string
+	err := sqlitex.ExecuteTransient(conn, "select name from main.pragma_table_info($table)", &sqlitex.ExecOptions{
+		Named: map[string]interface{}{"$table": table},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			columns = append(columns, stmt.ColumnText(0))
+			return nil
+		},
+	})
+	return columns, err
+}
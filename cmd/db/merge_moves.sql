@@ -0,0 +1,7 @@
+-- Builds stored under a <job>/<build ID> id in the database that the source
+-- has stored under the name of their ProwJob.
+select t.id, s.id
+from main.jobs t
+join source.jobs s on s.name = t.name and s.build_id = t.build_id
+where t.id = t.name || '/' || t.build_id
+and s.id != t.id;
\ No newline at end of file
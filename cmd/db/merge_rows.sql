@@ -0,0 +1,22 @@
+-- Decides what to do with each row of the source jobs table. A source row
+-- replaces a stored one if it is fresher: it has a final result and the
+-- stored one doesn't, or else it completed later, or else it has a ProwJob
+-- and the stored one doesn't. A build stored under another id is skipped.
+insert into temp.merge_rows (id, action)
+select s.id,
+  case
+    when exists (
+      select 1 from main.jobs o
+      where o.name = s.name and o.build_id = s.build_id and o.id != s.id
+    ) then 'skip'
+    when t.id is null then 'insert'
+    when (s.result is not null and s.result not in ('pending', 'unknown'))
+      != (t.result is not null and t.result not in ('pending', 'unknown'))
+      then case when t.result is null or t.result in ('pending', 'unknown') then 'update' else 'skip' end
+    when coalesce(s.completion_time, '') != coalesce(t.completion_time, '')
+      then case when coalesce(s.completion_time, '') > coalesce(t.completion_time, '') then 'update' else 'skip' end
+    when s.prowjob is not null and t.prowjob is null then 'update'
+    else 'skip'
+  end
+from source.jobs s
+left join main.jobs t on t.id = s.id;
\ No newline at end of file
@@ -0,0 +1,6 @@
+create temp table if not exists merge_rows (
+  id text not null primary key,
+  action text not null
+);
+
+delete from merge_rows;
\ No newline at end of file
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// mergeJob is the part of a stored build the merge rules look at. Empty
+// strings are stored as null.
+type mergeJob struct {
+	result, completionTime, prowJob, cluster string
+}
+
+func insertMergeJob(t *testing.T, conn *sqlite.Conn, job mergeJob) {
+	t.Helper()
+	null := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	err := sqlitex.Execute(conn, `insert into jobs (id, name, result, started, build_id, completion_time, prowjob, cluster)
+values ('periodic-foo/1', 'periodic-foo', $result, $started, '1', $completion_time, $prowjob, $cluster)`, &sqlitex.ExecOptions{
+		Named: map[string]interface{}{
+			"$result":          job.result,
+			"$started":         time.Now().Add(-time.Hour).Format(StartedLayout),
+			"$completion_time": null(job.completionTime),
+			"$prowjob":         null(job.prowJob),
+			"$cluster":         null(job.cluster),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeDBs(t *testing.T) {
+	tests := []struct {
+		name           string
+		target, source *mergeJob
+		want           mergeJob
+	}{
+		{
+			name:   "new build",
+			source: &mergeJob{result: "success", prowJob: "{}"},
+			want:   mergeJob{result: "success", prowJob: "{}"},
+		},
+		{
+			name:   "final result replaces pending",
+			target: &mergeJob{result: "pending"},
+			source: &mergeJob{result: "success"},
+			want:   mergeJob{result: "success"},
+		},
+		{
+			name:   "pending doesn't replace final result",
+			target: &mergeJob{result: "failure"},
+			source: &mergeJob{result: "pending"},
+			want:   mergeJob{result: "failure"},
+		},
+		{
+			name:   "completed later",
+			target: &mergeJob{result: "failure", completionTime: "2022-01-01T10:00:00Z"},
+			source: &mergeJob{result: "success", completionTime: "2022-01-01T11:00:00Z"},
+			want:   mergeJob{result: "success", completionTime: "2022-01-01T11:00:00Z"},
+		},
+		{
+			name:   "completed earlier",
+			target: &mergeJob{result: "success", completionTime: "2022-01-01T11:00:00Z"},
+			source: &mergeJob{result: "failure", completionTime: "2022-01-01T10:00:00Z"},
+			want:   mergeJob{result: "success", completionTime: "2022-01-01T11:00:00Z"},
+		},
+		{
+			name:   "has a ProwJob",
+			target: &mergeJob{result: "success"},
+			source: &mergeJob{result: "success", prowJob: "{}", cluster: "build01"},
+			want:   mergeJob{result: "success", prowJob: "{}", cluster: "build01"},
+		},
+		{
+			name:   "pruned ProwJob and metadata kept",
+			target: &mergeJob{result: "pending", prowJob: "{}", cluster: "build01"},
+			source: &mergeJob{result: "success"},
+			want:   mergeJob{result: "success", prowJob: "{}", cluster: "build01"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			for _, db := range []struct {
+				file string
+				job  *mergeJob
+			}{{"target.db", tt.target}, {"source.db", tt.source}} {
+				conn, err := Open(ctx, filepath.Join(dir, db.file))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if db.job != nil {
+					insertMergeJob(t, conn, *db.job)
+				}
+				conn.Close()
+			}
+
+			target := filepath.Join(dir, "target.db")
+			if err := mergeDBs(ctx, mergeOptions{OutputFile: target}, []string{filepath.Join(dir, "source.db")}); err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := OpenReadOnly(ctx, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			var got []mergeJob
+			err = sqlitex.ExecuteTransient(conn, "select result, coalesce(completion_time, ''), coalesce(prowjob, ''), coalesce(cluster, '') from jobs", &sqlitex.ExecOptions{
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					got = append(got, mergeJob{stmt.ColumnText(0), stmt.ColumnText(1), stmt.ColumnText(2), stmt.ColumnText(3)})
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("merged builds = %+v, want [%+v]", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ironcladlou/prowdb/cmd/exit"
+
+	"github.com/spf13/cobra"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+//go:embed schema_migrations.sql
+var schemaMigrationsQuery string
+
+//go:embed migrations_tracked.sql
+var migrationsTrackedQuery string
+
+//go:embed applied_migrations.sql
+var appliedMigrationsQuery string
+
+//go:embed record_migration.sql
+var recordMigrationQuery string
+
+// migrationFiles are the migrations written in SQL, named like
+// 0002_jobs_build_id.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is a numbered change to the schema. Migrations are applied in
+// order, each at most once, and recorded in the schema_migrations table.
+type migration struct {
+	version int
+	name    string
+	// script is the SQL of a migration written in SQL.
+	script string
+	// apply runs a migration written in Go.
+	apply func(conn *sqlite.Conn) error
+}
+
+// goMigrations are the migrations that can't be written in SQL alone. Their
+// versions are numbered in sequence with the files in migrations/.
+var goMigrations = []migration{}
+
+// migrations are all migrations, in order.
+var migrations = loadMigrations(migrationFiles, goMigrations)
+
+// loadMigrations returns the SQL migrations in the migrations directory of
+// files and the Go migrations together, ordered by version.
+func loadMigrations(files fs.FS, goMigrations []migration) []migration {
+	all := append([]migration{}, goMigrations...)
+	entries, err := fs.ReadDir(files, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			panic(fmt.Sprintf("migration %s isn't named like 0001_name.sql", entry.Name()))
+		}
+		script, err := fs.ReadFile(files, path.Join("migrations", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		all = append(all, migration{version: version, name: parts[1], script: string(script)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].version < all[j].version })
+	for i, m := range all {
+		if m.version != i+1 {
+			panic(fmt.Sprintf("migration %d %s is out of sequence", m.version, m.name))
+		}
+	}
+	return all
+}
+
+// latestVersion is the version of the newest migration.
+func latestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// appliedMigrations returns when each migration applied to the database was
+// applied. It doesn't write to the database, so one that has never been
+// migrated has none.
+func appliedMigrations(conn *sqlite.Conn) (map[int]string, error) {
+	applied := map[int]string{}
+	tracked := false
+	err := sqlitex.ExecuteTransient(conn, migrationsTrackedQuery, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			tracked = true
+			return nil
+		},
+	})
+	if err != nil || !tracked {
+		return applied, err
+	}
+	err = sqlitex.ExecuteTransient(conn, appliedMigrationsQuery, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			applied[stmt.ColumnInt(0)] = stmt.ColumnText(1)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for version := range applied {
+		if version > latestVersion() {
+			return nil, fmt.Errorf("database has migration %d, newer than the %d this version of prowdb knows", version, latestVersion())
+		}
+	}
+	return applied, nil
+}
+
+// migrate applies the migrations up to version to, or all of them if to is 0,
+// that haven't been applied yet. Each migration is applied in a savepoint, so
+// one that fails leaves the database at the previous version.
+func migrate(conn *sqlite.Conn, to int) ([]migration, error) {
+	if to == 0 {
+		to = latestVersion()
+	}
+	if err := sqlitex.ExecuteTransient(conn, schemaMigrationsQuery, nil); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+	var done []migration
+	for _, m := range migrations {
+		if m.version > to {
+			break
+		}
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		if err := applyMigration(conn, m); err != nil {
+			return done, fmt.Errorf("applying migration %d %s: %w", m.version, m.name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func applyMigration(conn *sqlite.Conn, m migration) (err error) {
+	defer sqlitex.Save(conn)(&err)
+	if m.apply != nil {
+		err = m.apply(conn)
+	} else {
+		err = sqlitex.ExecuteScript(conn, m.script, nil)
+	}
+	if err != nil {
+		return err
+	}
+	return sqlitex.ExecuteTransient(conn, recordMigrationQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+		"$version": m.version,
+		"$name":    m.name,
+		"$applied": time.Now().UTC().Format(time.RFC3339),
+	}})
+}
+
+type migrateOptions struct {
+	OutputFile string
+	Status     bool
+	To         int
+}
+
+func newMigrateCommand() *cobra.Command {
+	var options migrateOptions
+
+	var command = &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrades a database to the current schema.",
+		Long: `Upgrades a database to the current schema.
+
+Other commands apply pending migrations when they open a database, so this is
+only needed to check a database's version or to upgrade it part of the way.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.To < 0 || options.To > latestVersion() {
+				return exit.Usage(fmt.Errorf("invalid --to %d: must be from 1 to %d", options.To, latestVersion()))
+			}
+			return migrateDB(cmd.Context(), options)
+		},
+	}
+
+	command.Flags().StringVarP(&options.OutputFile, "output-file", "f", "prow.db", "database file location")
+	command.Flags().BoolVarP(&options.Status, "status", "", false, "list migrations and when they were applied instead of applying them")
+	command.Flags().IntVarP(&options.To, "to", "", 0, "apply migrations up to this version instead of all of them")
+
+	return command
+}
+
+func migrateDB(ctx context.Context, opts migrateOptions) error {
+	if opts.Status {
+		return migrationStatus(ctx, opts.OutputFile)
+	}
+
+	conn, err := openConn(ctx, opts.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return err
+	}
+	for version := range applied {
+		if opts.To > 0 && version > opts.To {
+			return fmt.Errorf("database already has migration %d; migrations can't be undone", version)
+		}
+	}
+	done, err := migrate(conn, opts.To)
+	for _, m := range done {
+		fmt.Printf("applied migration %d %s\n", m.version, m.name)
+	}
+	return err
+}
+
+// migrationStatus lists the migrations and when each was applied to the
+// database in file, without writing to it.
+func migrationStatus(ctx context.Context, file string) error {
+	conn, err := OpenReadOnly(ctx, file)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "VERSION\tNAME\tAPPLIED\n")
+	for _, m := range migrations {
+		when, ok := applied[m.version]
+		if !ok {
+			when = "pending"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.version, m.name, when)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestMigrateSQLAndGo(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/0001_first.sql": {Data: []byte("create table first (x integer);")},
+		"migrations/0003_third.sql": {Data: []byte("create table third (x integer);")},
+	}
+	second := migration{version: 2, name: "second", apply: func(conn *sqlite.Conn) error {
+		return sqlitex.ExecuteTransient(conn, "create table second (x integer)", nil)
+	}}
+	defer func(all []migration) { migrations = all }(migrations)
+	migrations = loadMigrations(files, []migration{second})
+
+	conn, err := openConn(context.Background(), filepath.Join(t.TempDir(), "prow.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// tables returns the tables the migrations created.
+	tables := func() []string {
+		t.Helper()
+		var names []string
+		err := sqlitex.ExecuteTransient(conn, "select name from sqlite_master where type = 'table' and name in ('first', 'second', 'third') order by rowid", &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				names = append(names, stmt.ColumnText(0))
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+	versions := func(done []migration) []int {
+		var applied []int
+		for _, m := range done {
+			applied = append(applied, m.version)
+		}
+		return applied
+	}
+
+	done, err := migrate(conn, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := versions(done), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("migrating to 2 applied %v, want %v", got, want)
+	}
+	if got, want := tables(), []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tables after migrating to 2 = %v, want %v", got, want)
+	}
+
+	done, err = migrate(conn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := versions(done), []int{3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("migrating to the latest applied %v, want %v", got, want)
+	}
+	if got, want := tables(), []string{"first", "second", "third"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tables after migrating to the latest = %v, want %v", got, want)
+	}
+
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 {
+		t.Errorf("recorded migrations %v, want 1 to 3", applied)
+	}
+	if n := count(t, conn, "select count(*) from schema_migrations where version = 2 and name = 'second'"); n != 1 {
+		t.Errorf("Go migration recorded %d times, want 1", n)
+	}
+}
+
+func TestLoadMigrationsOutOfSequence(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/0001_first.sql": {Data: []byte("create table first (x integer);")},
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a Go migration numbered like a SQL one to panic")
+		}
+	}()
+	loadMigrations(files, []migration{{version: 1, name: "first", apply: func(*sqlite.Conn) error { return nil }}})
+}
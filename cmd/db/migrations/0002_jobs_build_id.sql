@@ -0,0 +1,4 @@
+alter table jobs add column build_id text;
+
+-- The build ID is the last element of the build URL.
+update jobs set build_id = replace(url, rtrim(url, replace(url, '/', '')), '');
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- Jobs and builds that couldn't be read. build_id is empty for failures of a
+-- whole job, such as when its builds couldn't be listed.
+create table if not exists ingest_errors (
+  job text not null,
+  build_id text not null default '',
+  key text,
+  class text,
+  error text,
+  recorded text,
+  primary key (job, build_id)
+);
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- Test cases from the JUnit reports of each build. A test run more than once
+-- in a build has a row per run.
+create table if not exists test_cases (
+  job_id text not null references jobs(id),
+  build_id text,
+  suite text,
+  name text,
+  status text,
+  duration numeric,
+  message text
+);
+
+create index if not exists test_cases_job_id on test_cases(job_id);
+
+create index if not exists test_cases_name on test_cases(name, status);
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- Failure signatures matched in the build-log.txt of each build, with the
+-- first matching line.
+create table if not exists build_signatures (
+  job_id text not null references jobs(id),
+  build_id text,
+  signature text not null,
+  line integer,
+  text text,
+  primary key (job_id, signature)
+);
+
+create index if not exists build_signatures_signature on build_signatures(signature);
\ No newline at end of file
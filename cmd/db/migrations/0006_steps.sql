@@ -0,0 +1,16 @@
+-- Steps of each build from its ci-operator step graph. Substeps of multi-stage
+-- tests name the test as their parent. dependencies is a JSON array of step
+-- names.
+create table if not exists steps (
+  job_id text not null references jobs(id),
+  build_id text,
+  name text not null,
+  parent text,
+  started text,
+  duration numeric,
+  result text,
+  dependencies text,
+  primary key (job_id, name)
+);
+
+create index if not exists steps_name on steps(name, result);
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- Repositories checked out by each build, from the refs and extra_refs of its
+-- ProwJob. position is 0 for refs and counts up from 1 through extra_refs.
+create table if not exists refs (
+  job_id text not null references jobs(id),
+  build_id text,
+  position integer not null,
+  org text,
+  repo text,
+  base_ref text,
+  base_sha text,
+  primary key (job_id, position)
+);
+
+create index if not exists refs_repo on refs(org, repo, base_ref);
+
+create index if not exists refs_base_sha on refs(base_sha);
\ No newline at end of file
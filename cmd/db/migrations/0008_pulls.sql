@@ -0,0 +1,19 @@
+-- Pull requests merged into the refs of each build.
+create table if not exists pulls (
+  job_id text not null references jobs(id),
+  build_id text,
+  position integer not null,
+  org text,
+  repo text,
+  number integer not null,
+  author text,
+  sha text,
+  title text,
+  primary key (job_id, position, number)
+);
+
+create index if not exists pulls_number on pulls(org, repo, number);
+
+create index if not exists pulls_author on pulls(author);
+
+create index if not exists pulls_sha on pulls(sha);
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Build metadata is only known for rows written from now on.
+alter table jobs add column commit_hash text;
+
+create index if not exists jobs_commit_hash on jobs(commit_hash);
\ No newline at end of file
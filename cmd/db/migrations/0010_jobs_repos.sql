@@ -0,0 +1 @@
+alter table jobs add column repos text;
\ No newline at end of file
@@ -0,0 +1 @@
+alter table jobs add column repo_commit text;
\ No newline at end of file
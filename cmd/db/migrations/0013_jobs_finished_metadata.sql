@@ -0,0 +1 @@
+alter table jobs add column finished_metadata text;
\ No newline at end of file
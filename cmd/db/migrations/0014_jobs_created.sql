@@ -0,0 +1,5 @@
+-- Rows written before the ProwJob lifecycle columns existed take them from
+-- the stored ProwJob.
+alter table jobs add column created text;
+
+update jobs set created = json_extract(prowjob, '$.metadata.creationTimestamp') where json_valid(prowjob);
\ No newline at end of file
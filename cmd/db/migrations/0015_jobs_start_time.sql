@@ -0,0 +1,3 @@
+alter table jobs add column start_time text;
+
+update jobs set start_time = json_extract(prowjob, '$.status.startTime') where json_valid(prowjob);
\ No newline at end of file
@@ -0,0 +1,3 @@
+alter table jobs add column pending_time text;
+
+update jobs set pending_time = json_extract(prowjob, '$.status.pendingTime') where json_valid(prowjob);
\ No newline at end of file
@@ -0,0 +1,3 @@
+alter table jobs add column completion_time text;
+
+update jobs set completion_time = json_extract(prowjob, '$.status.completionTime') where json_valid(prowjob);
\ No newline at end of file
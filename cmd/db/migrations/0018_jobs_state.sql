@@ -0,0 +1,3 @@
+alter table jobs add column state text;
+
+update jobs set state = json_extract(prowjob, '$.status.state') where json_valid(prowjob);
\ No newline at end of file
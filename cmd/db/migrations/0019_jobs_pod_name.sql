@@ -0,0 +1,3 @@
+alter table jobs add column pod_name text;
+
+update jobs set pod_name = json_extract(prowjob, '$.status.pod_name') where json_valid(prowjob);
\ No newline at end of file
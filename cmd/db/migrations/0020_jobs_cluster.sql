@@ -0,0 +1,5 @@
+alter table jobs add column cluster text;
+
+update jobs set cluster = json_extract(prowjob, '$.spec.cluster') where json_valid(prowjob);
+
+create index if not exists jobs_cluster on jobs(cluster);
\ No newline at end of file
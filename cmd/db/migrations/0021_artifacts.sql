@@ -0,0 +1,11 @@
+-- Every file uploaded by each build, when ingested with --artifacts. name is
+-- relative to the build's directory.
+create table if not exists artifacts (
+  job_id text not null references jobs(id),
+  build_id text,
+  name text not null,
+  size integer,
+  content_type text,
+  content_encoding text,
+  primary key (job_id, name)
+);
\ No newline at end of file
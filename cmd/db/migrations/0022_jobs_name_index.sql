@@ -0,0 +1,2 @@
+-- Builds are looked up by job name when resuming and sampling.
+create index if not exists jobs_name on jobs(name);
\ No newline at end of file
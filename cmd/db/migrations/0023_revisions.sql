@@ -0,0 +1,76 @@
+-- Revisions of each build's row in jobs, recorded whenever it's written with
+-- different data. changed lists the columns that changed, and is null for the
+-- first revision.
+create table if not exists revisions (
+  job_id text not null,
+  build_id text,
+  revision integer not null,
+  recorded text,
+  result text,
+  state text,
+  changed text,
+  primary key (job_id, revision)
+);
+
+insert or ignore into revisions (job_id, build_id, revision, recorded, result, state)
+select id, build_id, 1, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'), result, state
+from jobs;
+
+create trigger if not exists jobs_insert_revision after insert on jobs
+begin
+  insert into revisions (job_id, build_id, revision, recorded, result, state)
+  values (
+    new.id, new.build_id,
+    coalesce((select max(revision) from revisions where job_id = new.id), 0) + 1,
+    strftime('%Y-%m-%dT%H:%M:%SZ', 'now'), new.result, new.state
+  );
+end;
+
+create trigger if not exists jobs_update_revision after update on jobs
+when old.name is not new.name
+  or old.result is not new.result
+  or old.started is not new.started
+  or old.duration is not new.duration
+  or old.url is not new.url
+  or old.prowjob is not new.prowjob
+  or old.build_id is not new.build_id
+  or old.commit_hash is not new.commit_hash
+  or old.repos is not new.repos
+  or old.repo_commit is not new.repo_commit
+  or old.started_metadata is not new.started_metadata
+  or old.finished_metadata is not new.finished_metadata
+  or old.created is not new.created
+  or old.start_time is not new.start_time
+  or old.pending_time is not new.pending_time
+  or old.completion_time is not new.completion_time
+  or old.state is not new.state
+  or old.pod_name is not new.pod_name
+  or old.cluster is not new.cluster
+begin
+  insert into revisions (job_id, build_id, revision, recorded, result, state, changed)
+  values (
+    new.id, new.build_id,
+    coalesce((select max(revision) from revisions where job_id = new.id), 0) + 1,
+    strftime('%Y-%m-%dT%H:%M:%SZ', 'now'), new.result, new.state,
+    substr(
+      case when old.name is not new.name then ',name' else '' end ||
+      case when old.result is not new.result then ',result' else '' end ||
+      case when old.started is not new.started then ',started' else '' end ||
+      case when old.duration is not new.duration then ',duration' else '' end ||
+      case when old.url is not new.url then ',url' else '' end ||
+      case when old.prowjob is not new.prowjob then ',prowjob' else '' end ||
+      case when old.build_id is not new.build_id then ',build_id' else '' end ||
+      case when old.commit_hash is not new.commit_hash then ',commit_hash' else '' end ||
+      case when old.repos is not new.repos then ',repos' else '' end ||
+      case when old.repo_commit is not new.repo_commit then ',repo_commit' else '' end ||
+      case when old.started_metadata is not new.started_metadata then ',started_metadata' else '' end ||
+      case when old.finished_metadata is not new.finished_metadata then ',finished_metadata' else '' end ||
+      case when old.created is not new.created then ',created' else '' end ||
+      case when old.start_time is not new.start_time then ',start_time' else '' end ||
+      case when old.pending_time is not new.pending_time then ',pending_time' else '' end ||
+      case when old.completion_time is not new.completion_time then ',completion_time' else '' end ||
+      case when old.state is not new.state then ',state' else '' end ||
+      case when old.pod_name is not new.pod_name then ',pod_name' else '' end ||
+      case when old.cluster is not new.cluster then ',cluster' else '' end, 2)
+  );
+end;
\ No newline at end of file
@@ -0,0 +1,3 @@
+select 1
+from sqlite_master
+where type = 'table' and name = 'schema_migrations';
\ No newline at end of file
@@ -0,0 +1,5 @@
+select cast(build_id as integer)
+from jobs
+where name = $name
+and result = 'pending'
+and build_id is not null;
\ No newline at end of file
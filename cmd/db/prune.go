@@ -0,0 +1,318 @@
+package db
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ironcladlou/prowdb/cmd/exit"
+
+	"github.com/spf13/cobra"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+//go:embed prune_candidates.sql
+var pruneCandidatesQuery string
+
+//go:embed prune_tables.sql
+var pruneTablesQuery string
+
+// retention keeps the builds of jobs matching a regular expression for a
+// period after they started.
+type retention struct {
+	jobs   *regexp.Regexp
+	period time.Duration
+}
+
+// parseRetention parses a policy given as <job regex>=<period>. The regex
+// must match the whole job name, and the period is a duration like 2160h or
+// a number of days like 90d.
+func parseRetention(policy string) (retention, error) {
+	i := strings.LastIndex(policy, "=")
+	if i < 0 {
+		return retention{}, fmt.Errorf("invalid policy %q: must be <job regex>=<period>", policy)
+	}
+	re, err := regexp.Compile("^(?:" + policy[:i] + ")$")
+	if err != nil {
+		return retention{}, fmt.Errorf("invalid policy %q: %w", policy, err)
+	}
+	value := policy[i+1:]
+	var period time.Duration
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return retention{}, fmt.Errorf("invalid policy %q: %w", policy, err)
+		}
+		period = time.Duration(n) * 24 * time.Hour
+	} else if period, err = time.ParseDuration(value); err != nil {
+		return retention{}, fmt.Errorf("invalid policy %q: %w", policy, err)
+	}
+	return retention{jobs: re, period: period}, nil
+}
+
+// expired reports whether the first policy matching job has expired a build
+// started at started.
+func expired(policies []retention, job string, started, now time.Time) bool {
+	for _, policy := range policies {
+		if policy.jobs.MatchString(job) {
+			return started.Before(now.Add(-policy.period))
+		}
+	}
+	return false
+}
+
+type pruneOptions struct {
+	OutputFile string
+	Retain     []string
+	RetainJSON []string
+	DryRun     bool
+}
+
+func newPruneCommand() *cobra.Command {
+	var options pruneOptions
+
+	var command = &cobra.Command{
+		Use:   "prune",
+		Short: "Deletes old builds from a database and compacts it.",
+		Long: `Deletes old builds from a database and compacts it.
+
+Policies are given as <job regex>=<period>, where the regex must match the
+whole job name and the period is a duration like 2160h or a number of days like
+90d. The first policy matching a job applies, and jobs matching none are kept.
+--retain deletes builds that started longer ago than the period, with their
+details. --retain-prowjob drops only the stored ProwJob, keeping the other
+columns of jobs and the details. For example:
+
+  prowdb db prune --retain 'pull-.*=90d' --retain 'periodic-.*=365d' --retain-prowjob '.*=30d'
+
+Freed pages are then returned to the file system with an incremental vacuum.
+A database created by an older version is converted with a full vacuum first.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(options.Retain) == 0 && len(options.RetainJSON) == 0 {
+				return exit.Usage(errors.New("at least one --retain or --retain-prowjob policy is required"))
+			}
+			return pruneDB(cmd.Context(), options)
+		},
+	}
+
+	command.Flags().StringVarP(&options.OutputFile, "output-file", "f", "prow.db", "database file location")
+	command.Flags().StringArrayVarP(&options.Retain, "retain", "", nil, "keep builds of jobs matching a regex for a period, as <job regex>=<period>")
+	command.Flags().StringArrayVarP(&options.RetainJSON, "retain-prowjob", "", nil, "keep the ProwJob of builds of jobs matching a regex for a period, as <job regex>=<period>")
+	command.Flags().BoolVarP(&options.DryRun, "dry-run", "", false, "report what would be deleted without deleting it")
+
+	return command
+}
+
+func parsePolicies(policies []string) ([]retention, error) {
+	var parsed []retention
+	for _, policy := range policies {
+		p, err := parseRetention(policy)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// pruned is what pruning deletes from a table.
+type pruned struct {
+	table string
+	rows  int64
+	bytes int64
+}
+
+func pruneDB(ctx context.Context, opts pruneOptions) error {
+	retain, err := parsePolicies(opts.Retain)
+	if err != nil {
+		return exit.Usage(err)
+	}
+	retainJSON, err := parsePolicies(opts.RetainJSON)
+	if err != nil {
+		return exit.Usage(err)
+	}
+
+	conn, err := Open(ctx, opts.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	report, err := prune(conn, retain, retainJSON, opts.DryRun)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "TABLE\tROWS\tBYTES\n")
+	var total int64
+	for _, p := range report {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", p.table, p.rows, p.bytes)
+		total += p.bytes
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		fmt.Printf("would free about %d bytes\n", total)
+		return nil
+	}
+
+	before, err := fileSize(conn)
+	if err != nil {
+		return err
+	}
+	if err := vacuum(conn); err != nil {
+		return err
+	}
+	after, err := fileSize(conn)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("freed %d bytes\n", before-after)
+	return nil
+}
+
+// prune deletes the builds expired by retain and drops the ProwJobs expired
+// by retainJSON in a single savepoint, or only reports them if dryRun is set.
+func prune(conn *sqlite.Conn, retain, retainJSON []retention, dryRun bool) (report []pruned, err error) {
+	defer sqlitex.Save(conn)(&err)
+
+	if err := sqlitex.ExecuteScript(conn, pruneTablesQuery, nil); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = sqlitex.ExecuteTransient(conn, pruneCandidatesQuery, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			id, job := stmt.ColumnText(0), stmt.ColumnText(1)
+			started, err := time.Parse(StartedLayout, stmt.ColumnText(2))
+			if err != nil {
+				return nil
+			}
+			table := ""
+			switch {
+			case expired(retain, job, started, now):
+				table = "prune_rows"
+			case stmt.ColumnBool(3) && expired(retainJSON, job, started, now):
+				table = "prune_prowjobs"
+			default:
+				return nil
+			}
+			return sqlitex.Execute(conn, fmt.Sprintf("insert into temp.%s (id) values ($id)", table), &sqlitex.ExecOptions{
+				Named: map[string]interface{}{"$id": id},
+			})
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range append([]string{"jobs"}, buildTables...) {
+		column := "job_id"
+		if table == "jobs" {
+			column = "id"
+		}
+		size, err := rowSize(conn, table)
+		if err != nil {
+			return nil, err
+		}
+		p := pruned{table: table}
+		err = sqlitex.ExecuteTransient(conn, fmt.Sprintf("select count(*), coalesce(sum(%s), 0) from %s where %s in (select id from temp.prune_rows)", size, table, column), &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				p.rows, p.bytes = stmt.ColumnInt64(0), stmt.ColumnInt64(1)
+				return nil
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, p)
+		if !dryRun {
+			err := sqlitex.ExecuteTransient(conn, fmt.Sprintf("delete from %s where %s in (select id from temp.prune_rows)", table, column), nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	p := pruned{table: "jobs.prowjob"}
+	err = sqlitex.ExecuteTransient(conn, "select count(*), coalesce(sum(length(prowjob)), 0) from jobs where id in (select id from temp.prune_prowjobs)", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			p.rows, p.bytes = stmt.ColumnInt64(0), stmt.ColumnInt64(1)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	report = append(report, p)
+	if !dryRun {
+		err := sqlitex.ExecuteTransient(conn, "update jobs set prowjob = null where id in (select id from temp.prune_prowjobs)", nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// rowSize returns an expression estimating the bytes stored in a row of
+// table, as the sum of the lengths of its values.
+func rowSize(conn *sqlite.Conn, table string) (string, error) {
+	columns, err := tableColumns(conn, table)
+	if err != nil {
+		return "", err
+	}
+	var lengths []string
+	for _, column := range columns {
+		lengths = append(lengths, fmt.Sprintf("coalesce(length(%s), 0)", column))
+	}
+	return strings.Join(lengths, " + "), nil
+}
+
+// autoVacuumIncremental is the auto_vacuum mode that frees pages on an
+// incremental vacuum.
+const autoVacuumIncremental = 2
+
+// vacuum returns free pages to the file system. Databases not yet in
+// incremental auto vacuum mode are converted by a full vacuum.
+func vacuum(conn *sqlite.Conn) error {
+	var mode int
+	err := sqlitex.ExecuteTransient(conn, "pragma auto_vacuum", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			mode = stmt.ColumnInt(0)
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if mode == autoVacuumIncremental {
+		return sqlitex.ExecuteTransient(conn, "pragma incremental_vacuum", nil)
+	}
+	log.Printf("converting the database to incremental vacuum with a full vacuum")
+	if err := sqlitex.ExecuteTransient(conn, "pragma auto_vacuum = incremental", nil); err != nil {
+		return err
+	}
+	return sqlitex.ExecuteTransient(conn, "vacuum", nil)
+}
+
+// fileSize returns the size of the database's pages in use and free.
+func fileSize(conn *sqlite.Conn) (int64, error) {
+	var pages, pageSize int64
+	err := sqlitex.ExecuteTransient(conn, "select page_count, page_size from pragma_page_count(), pragma_page_size()", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			pages, pageSize = stmt.ColumnInt64(0), stmt.ColumnInt64(1)
+			return nil
+		},
+	})
+	return pages * pageSize, err
+}
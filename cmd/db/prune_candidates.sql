@@ -0,0 +1,2 @@
+select id, name, started, prowjob is not null
+from jobs;
\ No newline at end of file
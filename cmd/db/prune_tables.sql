@@ -0,0 +1,11 @@
+create temp table if not exists prune_rows (
+  id text not null primary key
+);
+
+create temp table if not exists prune_prowjobs (
+  id text not null primary key
+);
+
+delete from prune_rows;
+
+delete from prune_prowjobs;
\ No newline at end of file
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// count returns the single integer query returns.
+func count(t *testing.T, conn *sqlite.Conn, query string) int64 {
+	t.Helper()
+	var n int64
+	err := sqlitex.ExecuteTransient(conn, query, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			n = stmt.ColumnInt64(0)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPruneProwJobsAddsNoRevisions(t *testing.T) {
+	conn, err := Open(context.Background(), filepath.Join(t.TempDir(), "prow.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	started := time.Now().Add(-48 * time.Hour).Format(StartedLayout)
+	for _, id := range []string{"old-1", "old-2"} {
+		err := sqlitex.Execute(conn, "insert into jobs (id, name, result, started, prowjob, build_id, state) values ($id, 'periodic-foo', 'success', $started, '{}', $id, 'success')", &sqlitex.ExecOptions{
+			Named: map[string]interface{}{"$id": id, "$started": started},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	revisions := count(t, conn, "select count(*) from revisions")
+
+	policy, err := parseRetention(".*=24h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := prune(conn, nil, []retention{policy}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, conn, "select count(*) from jobs where prowjob is not null"); n != 0 {
+		t.Errorf("%d ProwJobs left after pruning", n)
+	}
+	if n := count(t, conn, "select count(*) from revisions"); n != revisions {
+		t.Errorf("pruning ProwJobs changed the revisions from %d to %d", revisions, n)
+	}
+}
@@ -0,0 +1,5 @@
+insert or replace into ingest_errors (
+  job, build_id, key, class, error, recorded
+) values (
+  $job, $build_id, $key, $class, $error, $recorded
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+insert into schema_migrations (version, name, applied)
+values ($version, $name, $applied);
\ No newline at end of file
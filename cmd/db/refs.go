@@ -0,0 +1,80 @@
+package db
+
+import (
+	_ "embed"
+
+	"github.com/ironcladlou/prowdb/prow"
+
+	v1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+//go:embed insert_ref.sql
+var insertRefQuery string
+
+//go:embed insert_pull.sql
+var insertPullQuery string
+
+//go:embed clear_refs.sql
+var clearRefsQuery string
+
+//go:embed clear_pulls.sql
+var clearPullsQuery string
+
+// writeRefs replaces the stored refs and pulls of a build with those of its
+// ProwJob.
+func writeRefs(conn *sqlite.Conn, jobID string, build prow.Build) error {
+	for _, query := range []string{clearRefsQuery, clearPullsQuery} {
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{Named: map[string]interface{}{
+			"$job_id": jobID,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+
+	var refs []v1.Refs
+	if build.ProwJob.Spec.Refs != nil {
+		refs = append(refs, *build.ProwJob.Spec.Refs)
+	} else {
+		// keep extra refs numbered from 1
+		refs = append(refs, v1.Refs{})
+	}
+	refs = append(refs, build.ProwJob.Spec.ExtraRefs...)
+
+	for position, ref := range refs {
+		if ref.Org == "" && ref.Repo == "" {
+			continue
+		}
+		err := sqlitex.Execute(conn, insertRefQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+			"$job_id":   jobID,
+			"$build_id": build.ID,
+			"$position": position,
+			"$org":      ref.Org,
+			"$repo":     ref.Repo,
+			"$base_ref": ref.BaseRef,
+			"$base_sha": ref.BaseSHA,
+		}})
+		if err != nil {
+			return err
+		}
+		for _, pull := range ref.Pulls {
+			err := sqlitex.Execute(conn, insertPullQuery, &sqlitex.ExecOptions{Named: map[string]interface{}{
+				"$job_id":   jobID,
+				"$build_id": build.ID,
+				"$position": position,
+				"$org":      ref.Org,
+				"$repo":     ref.Repo,
+				"$number":   pull.Number,
+				"$author":   pull.Author,
+				"$sha":      pull.SHA,
+				"$title":    pull.Title,
+			}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
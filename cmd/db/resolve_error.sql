@@ -0,0 +1,3 @@
+delete from ingest_errors
+where job = $job
+and build_id = $build_id;
\ No newline at end of file
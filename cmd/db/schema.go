@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// busyTimeout is how long to wait for another connection writing to the
+// database.
+const busyTimeout = time.Minute
+
+// Open opens the database in file, creating it and applying any pending
+// migrations as needed. Statements are interrupted once ctx is done.
+func Open(ctx context.Context, file string) (*sqlite.Conn, error) {
+	conn, err := openConn(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	done, err := migrate(conn, 0)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for _, m := range done {
+		log.Printf("applied migration %d %s", m.version, m.name)
+	}
+	return conn, nil
+}
+
+// openConn opens the database in file without migrating it.
+func openConn(ctx context.Context, file string) (*sqlite.Conn, error) {
+	conn, err := sqlite.OpenConn(file, sqlite.OpenReadWrite, sqlite.OpenCreate)
+	if err != nil {
+		return nil, err
+	}
+	// Interrupting stops the statement in flight, and the savepoint around
+	// it rolls back.
+	conn.SetInterrupt(ctx.Done())
+	// Readers, like stats run during an ingest, don't block the writer in
+	// WAL mode, and a writer waits a while for another to finish.
+	conn.SetBusyTimeout(busyTimeout)
+	// Pages freed by db prune can be returned to the file system without a
+	// full vacuum. This only takes effect on a new database.
+	if err := sqlitex.ExecuteTransient(conn, "pragma auto_vacuum = incremental", nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := sqlitex.ExecuteTransient(conn, "pragma journal_mode = wal", nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// OpenReadOnly opens the existing database in file for reading. Unlike Open
+// and openConn it never writes to the file, so it neither migrates the
+// database nor switches it to WAL mode.
+func OpenReadOnly(ctx context.Context, file string) (*sqlite.Conn, error) {
+	conn, err := sqlite.OpenConn(file, sqlite.OpenReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetInterrupt(ctx.Done())
+	conn.SetBusyTimeout(busyTimeout)
+	return conn, nil
+}
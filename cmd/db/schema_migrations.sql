@@ -0,0 +1,5 @@
+create table if not exists schema_migrations (
+  version integer not null primary key,
+  name text,
+  applied text
+);
\ No newline at end of file
@@ -1,5 +1,32 @@
-insert or replace into jobs (
-  id, name, result, started, duration, url, prowjob
+insert into jobs (
+  id, name, result, started, duration, url, prowjob, build_id,
+  commit_hash, repos, repo_commit, started_metadata, finished_metadata,
+  created, start_time, pending_time, completion_time, state, pod_name, cluster
 ) values (
-  $id, $name, $result, $started, $duration, $url, $prowjob
-);
\ No newline at end of file
+  $id, $name, $result, $started, $duration, $url, $prowjob, $build_id,
+  $commit_hash, $repos, $repo_commit, $started_metadata, $finished_metadata,
+  $created, $start_time, $pending_time, $completion_time, $state, $pod_name, $cluster
+)
+-- A build read again while some of its files can't be read keeps what was
+-- stored from them before: a final result isn't downgraded to pending or
+-- unknown, and missing metadata and ProwJob fields are kept.
+on conflict (id) do update set
+  name = excluded.name,
+  result = case when jobs.result not in ('pending', 'unknown') and excluded.result in ('pending', 'unknown') then jobs.result else excluded.result end,
+  started = excluded.started,
+  duration = case when jobs.result not in ('pending', 'unknown') and excluded.result in ('pending', 'unknown') then jobs.duration else excluded.duration end,
+  url = excluded.url,
+  prowjob = coalesce(excluded.prowjob, jobs.prowjob),
+  build_id = excluded.build_id,
+  commit_hash = coalesce(excluded.commit_hash, jobs.commit_hash),
+  repos = coalesce(excluded.repos, jobs.repos),
+  repo_commit = coalesce(excluded.repo_commit, jobs.repo_commit),
+  started_metadata = coalesce(excluded.started_metadata, jobs.started_metadata),
+  finished_metadata = coalesce(excluded.finished_metadata, jobs.finished_metadata),
+  created = coalesce(excluded.created, jobs.created),
+  start_time = coalesce(excluded.start_time, jobs.start_time),
+  pending_time = coalesce(excluded.pending_time, jobs.pending_time),
+  completion_time = coalesce(excluded.completion_time, jobs.completion_time),
+  state = coalesce(excluded.state, jobs.state),
+  pod_name = coalesce(excluded.pod_name, jobs.pod_name),
+  cluster = coalesce(excluded.cluster, jobs.cluster);
\ No newline at end of file
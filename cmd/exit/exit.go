@@ -0,0 +1,57 @@
+// Package exit maps command errors to process exit codes.
+package exit
+
+import "errors"
+
+// Exit codes returned by prowdb.
+const (
+	// OK means the command did everything it was asked.
+	OK = 0
+	// Failure means the command failed without producing any results.
+	Failure = 1
+	// UsageError means the command line couldn't be parsed or a flag's
+	// value is invalid.
+	UsageError = 2
+	// PartialFailure means some jobs or builds couldn't be read, but the
+	// rest were output or stored.
+	PartialFailure = 3
+	// Interrupted means the command was stopped by SIGINT or SIGTERM before
+	// it finished. Nothing half-written is left in the database.
+	Interrupted = 130
+)
+
+type codedError struct {
+	code int
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// Usage marks err as a problem with the command line.
+func Usage(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: UsageError, err: err}
+}
+
+// Partial marks err as a failure to read some of the requested data.
+func Partial(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code: PartialFailure, err: err}
+}
+
+// Code returns the exit code for the error a command returned.
+func Code(err error) int {
+	if err == nil {
+		return OK
+	}
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return Failure
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
 
+	"github.com/ironcladlou/prowdb/cmd/exit"
 	"github.com/ironcladlou/prowdb/prow"
 	"github.com/spf13/cobra"
 )
@@ -22,9 +22,8 @@ func NewCommand() *cobra.Command {
 }
 
 type histShowOptions struct {
-	BaseURL string
-	From    time.Duration
-	Jobs    []string
+	prow.HistoryOptions
+	prow.JobSelector
 }
 
 func newHistShowCommand() *cobra.Command {
@@ -33,30 +32,42 @@ func newHistShowCommand() *cobra.Command {
 	var command = &cobra.Command{
 		Use:   "show",
 		Short: "Shows job history in a machine consumable format.",
-		Run: func(cmd *cobra.Command, args []string) {
-			err := renderHistory(context.TODO(), options)
-			if err != nil {
-				panic(err)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := options.Complete(cmd.Flags()); err != nil {
+				return err
 			}
+			if err := options.SourceOptions.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			if err := options.JobSelector.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			return renderHistory(cmd.Context(), options)
 		},
 	}
 
-	command.Flags().StringVarP(&options.BaseURL, "base-url", "", prow.DefaultBaseURL, "")
-	command.Flags().DurationVarP(&options.From, "from", "", 24*time.Hour, "how far back to find builds")
-	command.Flags().StringArrayVarP(&options.Jobs, "job", "", []string{"pull-ci-openshift-hypershift-main-e2e-aws"}, "jobs to find")
+	options.HistoryOptions.AddFlags(command.Flags())
+	options.JobSelector.AddFlags(command.Flags())
 
 	return command
 }
 
 func renderHistory(ctx context.Context, opts histShowOptions) error {
-	builds, err := prow.GetJobHistoryByJobName(ctx, opts.BaseURL, opts.From, opts.Jobs...)
+	jobs, err := prow.SelectJobs(ctx, &opts.SourceOptions, opts.JobSelector)
 	if err != nil {
 		return err
 	}
+	builds, fetchErr := prow.GetJobHistoryByJobName(ctx, opts.HistoryOptions, jobs...)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	out, err := json.MarshalIndent(builds, "", "  ")
 	if err != nil {
 		return err
 	}
 	fmt.Println(string(out))
-	return nil
+	if len(builds) > 0 {
+		return exit.Partial(fetchErr)
+	}
+	return fetchErr
 }
@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ironcladlou/prowdb/cmd/exit"
+	"github.com/ironcladlou/prowdb/prow"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "jobs",
+		Short: "Prow job discovery tool",
+	}
+
+	command.AddCommand(newJobsListCommand())
+
+	return command
+}
+
+type jobsListOptions struct {
+	prow.SourceOptions
+	prow.JobSelector
+}
+
+func newJobsListCommand() *cobra.Command {
+	var options jobsListOptions
+
+	var command = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the jobs matching the given selectors.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := options.Complete(cmd.Flags()); err != nil {
+				return err
+			}
+			if err := options.SourceOptions.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			if err := options.JobSelector.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			return listJobs(cmd.Context(), options)
+		},
+	}
+
+	options.SourceOptions.AddFlags(command.Flags())
+	options.JobSelector.AddFlags(command.Flags())
+
+	return command
+}
+
+func listJobs(ctx context.Context, opts jobsListOptions) error {
+	jobs, err := prow.SelectJobs(ctx, &opts.SourceOptions, opts.JobSelector)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		fmt.Println(job)
+	}
+	return nil
+}
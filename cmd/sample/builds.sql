@@ -0,0 +1,6 @@
+-- The build ID is the last element of the build URL, which databases of every
+-- version store.
+select replace(url, rtrim(url, replace(url, '/', '')), '') as build_id, result, started, url
+from jobs
+where name = $name
+order by cast(build_id as integer) desc;
\ No newline at end of file
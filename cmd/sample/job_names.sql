@@ -0,0 +1,4 @@
+select distinct name
+from jobs
+where name is not null
+order by name;
\ No newline at end of file
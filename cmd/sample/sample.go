@@ -0,0 +1,275 @@
+package sample
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ironcladlou/prowdb/cmd/db"
+	"github.com/ironcladlou/prowdb/cmd/exit"
+	"github.com/ironcladlou/prowdb/prow"
+
+	"github.com/spf13/cobra"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+//go:embed job_names.sql
+var jobNamesQuery string
+
+//go:embed builds.sql
+var buildsQuery string
+
+var intervals = map[string]bool{"hour": true, "day": true, "week": true}
+
+var outputs = map[string]bool{"url": true, "id": true, "path": true}
+
+type sampleOptions struct {
+	prow.HistoryOptions
+	prow.JobSelector
+	// DBFile names a database to sample instead of the bucket.
+	DBFile   string
+	Count    int
+	Interval string
+	Results  []string
+	Output   string
+}
+
+func NewCommand() *cobra.Command {
+	var options sampleOptions
+
+	var command = &cobra.Command{
+		Use:   "sample",
+		Short: "Picks a few builds of each job per hour, day or week.",
+		Long: `Picks a few builds of each job per hour, day or week.
+
+The newest --count builds of each job started in each interval are output,
+newest first, one per line: their URL, build ID, or the path of their files in
+the bucket, like gs://origin-ci-test/logs/<job>/<build>. Intervals are in UTC
+and weeks start on Monday. Builds are read from the bucket, or from a database
+built by db create if --db is given.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if options.Count < 1 {
+				return exit.Usage(fmt.Errorf("invalid --count %d: must be at least 1", options.Count))
+			}
+			if !intervals[options.Interval] {
+				return exit.Usage(fmt.Errorf("invalid --interval %q: must be hour, day or week", options.Interval))
+			}
+			if !outputs[options.Output] {
+				return exit.Usage(fmt.Errorf("invalid --output %q: must be url, id or path", options.Output))
+			}
+			if err := options.Complete(cmd.Flags()); err != nil {
+				return err
+			}
+			if err := options.SourceOptions.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			if err := options.JobSelector.Validate(); err != nil {
+				return exit.Usage(err)
+			}
+			return sampleBuilds(cmd.Context(), options)
+		},
+	}
+
+	options.HistoryOptions.AddFlags(command.Flags())
+	options.JobSelector.AddFlags(command.Flags())
+	command.Flags().StringVarP(&options.DBFile, "db", "", "", "database to sample instead of the bucket")
+	command.Flags().IntVarP(&options.Count, "count", "n", 1, "builds to pick per job per interval")
+	command.Flags().StringVarP(&options.Interval, "interval", "", "day", "interval to pick builds from: hour, day or week")
+	command.Flags().StringSliceVarP(&options.Results, "result", "", []string{"success"}, "results of builds to pick, or empty for any")
+	command.Flags().StringVarP(&options.Output, "output", "o", "url", "what to output for each build: url, id or path")
+
+	return command
+}
+
+// build is the part of a build needed to sample it.
+type build struct {
+	job     string
+	id      string
+	result  string
+	started time.Time
+	url     string
+	path    string
+}
+
+func sampleBuilds(ctx context.Context, opts sampleOptions) error {
+	var builds []build
+	var fetchErr error
+	if opts.DBFile != "" {
+		var err error
+		builds, err = readDB(ctx, opts)
+		if err != nil {
+			return err
+		}
+	} else {
+		jobs, err := prow.SelectJobs(ctx, &opts.SourceOptions, opts.JobSelector)
+		if err != nil {
+			return err
+		}
+		var found []prow.Build
+		found, fetchErr = prow.GetJobHistoryByJobName(ctx, opts.HistoryOptions, jobs...)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, b := range found {
+			builds = append(builds, build{
+				job:     b.Job,
+				id:      b.ID,
+				result:  b.Result,
+				started: b.Started,
+				url:     b.URL,
+				path:    bucketPath(opts.Storage.Provider, opts.Storage.Bucket, b.Prefix),
+			})
+		}
+	}
+
+	for _, b := range pick(builds, opts) {
+		switch opts.Output {
+		case "url":
+			fmt.Println(b.url)
+		case "id":
+			fmt.Println(b.id)
+		case "path":
+			fmt.Println(b.path)
+		}
+	}
+	if len(builds) > 0 {
+		return exit.Partial(fetchErr)
+	}
+	return fetchErr
+}
+
+// pick returns the newest opts.Count builds of each job in each interval with
+// one of opts.Results, keeping the order builds were given in. Builds must be
+// given newest first within each job.
+func pick(builds []build, opts sampleOptions) []build {
+	picked := map[string]int{}
+	var sample []build
+	for _, b := range builds {
+		if !hasResult(b, opts.Results) || b.started.IsZero() {
+			continue
+		}
+		key := b.job + "\x00" + interval(b.started, opts.Interval).Format(time.RFC3339)
+		if picked[key] >= opts.Count {
+			continue
+		}
+		picked[key]++
+		sample = append(sample, b)
+	}
+	return sample
+}
+
+func hasResult(b build, results []string) bool {
+	if len(results) == 0 {
+		return true
+	}
+	for _, result := range results {
+		if strings.EqualFold(b.result, result) {
+			return true
+		}
+	}
+	return false
+}
+
+// interval returns the start of the interval t falls in.
+func interval(t time.Time, name string) time.Time {
+	t = t.UTC()
+	switch name {
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// bucketPath returns the location of a build's files in the style of gsutil,
+// or the local path for a bucket on local disk.
+func bucketPath(provider, bucket, prefix string) string {
+	if provider == prow.FileStorageProvider {
+		return strings.TrimSuffix(bucket, "/") + "/" + prefix
+	}
+	return provider + "://" + bucket + "/" + prefix
+}
+
+// pathFromURL returns the location of a build's files from its Spyglass URL,
+// which ends with /view/<provider>/<bucket>/<prefix>.
+func pathFromURL(buildURL string) string {
+	u, err := url.Parse(buildURL)
+	if err != nil {
+		return ""
+	}
+	i := strings.Index(u.Path, "/view/")
+	if i < 0 {
+		return ""
+	}
+	parts := strings.SplitN(u.Path[i+len("/view/"):], "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	if parts[0] == prow.FileStorageProvider {
+		return "/" + parts[1]
+	}
+	bucketPrefix := strings.SplitN(parts[1], "/", 2)
+	if len(bucketPrefix) < 2 {
+		return ""
+	}
+	return bucketPath(parts[0], bucketPrefix[0], bucketPrefix[1])
+}
+
+// readDB reads the builds of the selected jobs started within opts.From from a
+// database, newest first within each job.
+func readDB(ctx context.Context, opts sampleOptions) ([]build, error) {
+	conn, err := db.OpenReadOnly(ctx, opts.DBFile)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var known []string
+	err = sqlitex.ExecuteTransient(conn, jobNamesQuery, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			known = append(known, stmt.ColumnText(0))
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading job names: %w", err)
+	}
+	jobs, err := prow.FilterJobs(known, opts.JobSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Now().Add(-opts.From)
+	var builds []build
+	for _, job := range jobs {
+		err := sqlitex.ExecuteTransient(conn, buildsQuery, &sqlitex.ExecOptions{
+			Named: map[string]interface{}{"$name": job},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				started, err := time.Parse(db.StartedLayout, stmt.ColumnText(2))
+				if err != nil || started.Before(since) {
+					return nil
+				}
+				builds = append(builds, build{
+					job:     job,
+					id:      stmt.ColumnText(0),
+					result:  stmt.ColumnText(1),
+					started: started,
+					url:     stmt.ColumnText(3),
+					path:    pathFromURL(stmt.ColumnText(3)),
+				})
+				return nil
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading builds of job %s: %w", job, err)
+		}
+	}
+	return builds, nil
+}
@@ -0,0 +1,144 @@
+package sample
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        string
+		interval string
+		want     string
+	}{
+		{name: "hour", t: "2022-01-05T10:59:59Z", interval: "hour", want: "2022-01-05T10:00:00Z"},
+		{name: "day", t: "2022-01-05T23:59:59Z", interval: "day", want: "2022-01-05T00:00:00Z"},
+		{name: "day in UTC", t: "2022-01-05T01:00:00+03:00", interval: "day", want: "2022-01-04T00:00:00Z"},
+		{name: "week from Monday", t: "2022-01-03T00:00:00Z", interval: "week", want: "2022-01-03T00:00:00Z"},
+		{name: "week from Wednesday", t: "2022-01-05T12:00:00Z", interval: "week", want: "2022-01-03T00:00:00Z"},
+		{name: "week from Sunday", t: "2022-01-09T23:59:59Z", interval: "week", want: "2022-01-03T00:00:00Z"},
+		{name: "week across a year", t: "2022-01-02T12:00:00Z", interval: "week", want: "2021-12-27T00:00:00Z"},
+		{name: "week in UTC", t: "2022-01-03T01:00:00+03:00", interval: "week", want: "2021-12-27T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := time.Parse(time.RFC3339, tt.t)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := interval(in, tt.interval).Format(time.RFC3339); got != tt.want {
+				t.Errorf("interval(%s, %s) = %s, want %s", tt.t, tt.interval, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPick(t *testing.T) {
+	day := time.Date(2022, 1, 5, 0, 0, 0, 0, time.UTC)
+	// Builds are given newest first within each job.
+	builds := []build{
+		{job: "a", id: "4", result: "SUCCESS", started: day.Add(26 * time.Hour)},
+		{job: "a", id: "3", result: "FAILURE", started: day.Add(14 * time.Hour)},
+		{job: "a", id: "2", result: "SUCCESS", started: day.Add(12 * time.Hour)},
+		{job: "a", id: "1", result: "success", started: day.Add(2 * time.Hour)},
+		{job: "a", id: "0", result: "SUCCESS"},
+		{job: "b", id: "2", result: "SUCCESS", started: day.Add(13 * time.Hour)},
+		{job: "b", id: "1", result: "PENDING", started: day.Add(11 * time.Hour)},
+	}
+	tests := []struct {
+		name string
+		opts sampleOptions
+		// want are the job/id of the builds picked.
+		want []string
+	}{
+		{
+			name: "newest per job per day",
+			opts: sampleOptions{Count: 1, Interval: "day", Results: []string{"success"}},
+			want: []string{"a/4", "a/2", "b/2"},
+		},
+		{
+			name: "count",
+			opts: sampleOptions{Count: 2, Interval: "day", Results: []string{"success"}},
+			want: []string{"a/4", "a/2", "a/1", "b/2"},
+		},
+		{
+			name: "any result",
+			opts: sampleOptions{Count: 1, Interval: "day"},
+			want: []string{"a/4", "a/3", "b/2"},
+		},
+		{
+			name: "several results",
+			opts: sampleOptions{Count: 1, Interval: "hour", Results: []string{"failure", "pending"}},
+			want: []string{"a/3", "b/1"},
+		},
+		{
+			name: "week",
+			opts: sampleOptions{Count: 1, Interval: "week", Results: []string{"success"}},
+			want: []string{"a/4", "b/2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, b := range pick(builds, tt.opts) {
+				got = append(got, b.job+"/"+b.id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pick() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathFromURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "gs",
+			url:  "https://prow.ci.openshift.org/view/gs/origin-ci-test/logs/periodic-foo/1234",
+			want: "gs://origin-ci-test/logs/periodic-foo/1234",
+		},
+		{
+			name: "pr logs",
+			url:  "https://prow.ci.openshift.org/view/gs/origin-ci-test/pr-logs/pull/openshift_hypershift/1/pull-foo/1234",
+			want: "gs://origin-ci-test/pr-logs/pull/openshift_hypershift/1/pull-foo/1234",
+		},
+		{
+			name: "local directory",
+			url:  "https://prow.ci.openshift.org/view/file/tmp/mirror/logs/periodic-foo/1234",
+			want: "/tmp/mirror/logs/periodic-foo/1234",
+		},
+		{
+			name: "no view",
+			url:  "https://prow.ci.openshift.org/job-history/gs/origin-ci-test/logs/periodic-foo",
+			want: "",
+		},
+		{
+			name: "no prefix",
+			url:  "https://prow.ci.openshift.org/view/gs/origin-ci-test",
+			want: "",
+		},
+		{
+			name: "no bucket",
+			url:  "https://prow.ci.openshift.org/view/gs",
+			want: "",
+		},
+		{
+			name: "invalid",
+			url:  "%zz",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pathFromURL(tt.url); got != tt.want {
+				t.Errorf("pathFromURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
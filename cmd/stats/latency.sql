@@ -0,0 +1,3 @@
+select name, cluster, created, pending_time, started, completion_time
+from jobs
+where created >= $since;
\ No newline at end of file
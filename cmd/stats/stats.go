@@ -0,0 +1,178 @@
+package stats
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ironcladlou/prowdb/cmd/db"
+	"github.com/ironcladlou/prowdb/cmd/exit"
+
+	"github.com/spf13/cobra"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+//go:embed latency.sql
+var latencyQuery string
+
+func NewCommand() *cobra.Command {
+	var command = &cobra.Command{
+		Use:   "stats",
+		Short: "Reports statistics from a prow database.",
+	}
+
+	command.AddCommand(newLatencyCommand())
+
+	return command
+}
+
+type latencyOptions struct {
+	OutputFile string
+	From       time.Duration
+	GroupBy    []string
+}
+
+func newLatencyCommand() *cobra.Command {
+	var options latencyOptions
+
+	var command = &cobra.Command{
+		Use:   "latency",
+		Short: "Reports how long builds wait to be scheduled and to start, and how long they run.",
+		Long: `Reports how long builds wait to be scheduled and to start, and how long they run.
+
+Queue time is from the ProwJob's creation until its pod is created. Pending time
+is from then until the test starts, covering scheduling, image pulls and
+cloning. Run time is from the test starting until the ProwJob completes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, by := range options.GroupBy {
+				if by != "job" && by != "cluster" {
+					return exit.Usage(fmt.Errorf("invalid --by %q: must be job or cluster", by))
+				}
+			}
+			return reportLatency(cmd.Context(), options)
+		},
+	}
+
+	command.Flags().StringVarP(&options.OutputFile, "output-file", "f", "prow.db", "database file location")
+	command.Flags().DurationVarP(&options.From, "from", "", 0, "only builds created this long ago or later, or 0 for all")
+	command.Flags().StringSliceVarP(&options.GroupBy, "by", "", []string{"job"}, "group builds by job, cluster or both")
+
+	return command
+}
+
+// latencies are the durations of each phase of a group of builds.
+type latencies struct {
+	builds              int
+	queue, pending, run []time.Duration
+}
+
+func reportLatency(ctx context.Context, opts latencyOptions) error {
+	if _, err := os.Stat(opts.OutputFile); err != nil {
+		return err
+	}
+	conn, err := db.OpenReadOnly(ctx, opts.OutputFile)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	groups, err := readLatencies(conn, opts)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tBUILDS\tQUEUE P50\tQUEUE P90\tPENDING P50\tPENDING P90\tRUN P50\tRUN P90\n", strings.ToUpper(strings.Join(opts.GroupBy, "\t")))
+	for _, key := range keys {
+		group := groups[key]
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", key, group.builds,
+			percentile(group.queue, 50), percentile(group.queue, 90),
+			percentile(group.pending, 50), percentile(group.pending, 90),
+			percentile(group.run, 50), percentile(group.run, 90))
+	}
+	return w.Flush()
+}
+
+// readLatencies reads the phases of the builds created within opts.From,
+// keyed by the tab-separated values of the opts.GroupBy columns.
+func readLatencies(conn *sqlite.Conn, opts latencyOptions) (map[string]*latencies, error) {
+	var since string
+	if opts.From > 0 {
+		since = time.Now().Add(-opts.From).UTC().Format(time.RFC3339)
+	}
+
+	groups := map[string]*latencies{}
+	err := sqlitex.ExecuteTransient(conn, latencyQuery, &sqlitex.ExecOptions{
+		Named: map[string]interface{}{"$since": since},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			var fields []string
+			for _, by := range opts.GroupBy {
+				switch by {
+				case "job":
+					fields = append(fields, stmt.ColumnText(0))
+				case "cluster":
+					fields = append(fields, stmt.ColumnText(1))
+				}
+			}
+			key := strings.Join(fields, "\t")
+			group, ok := groups[key]
+			if !ok {
+				group = &latencies{}
+				groups[key] = group
+			}
+			group.builds++
+
+			created := parseTime(time.RFC3339, stmt.ColumnText(2))
+			pending := parseTime(time.RFC3339, stmt.ColumnText(3))
+			started := parseTime(db.StartedLayout, stmt.ColumnText(4))
+			completed := parseTime(time.RFC3339, stmt.ColumnText(5))
+			group.queue = appendPhase(group.queue, created, pending)
+			group.pending = appendPhase(group.pending, pending, started)
+			group.run = appendPhase(group.run, started, completed)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// parseTime returns the zero time for values that are missing or malformed.
+func parseTime(layout, value string) time.Time {
+	t, _ := time.Parse(layout, value)
+	return t
+}
+
+// appendPhase adds the time between from and to, if both are known and in
+// order.
+func appendPhase(phases []time.Duration, from, to time.Time) []time.Duration {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return phases
+	}
+	return append(phases, to.Sub(from))
+}
+
+func percentile(durations []time.Duration, p int) string {
+	if len(durations) == 0 {
+		return "-"
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	i := (len(durations)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+	return durations[i].Round(time.Second).String()
+}
@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ironcladlou/prowdb/cmd/db"
+
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// latencyBuild is a stored build, with its phases given as offsets from its
+// creation. A zero offset is stored as null.
+type latencyBuild struct {
+	job, cluster                string
+	age                         time.Duration
+	pending, started, completed time.Duration
+}
+
+func TestReadLatencies(t *testing.T) {
+	builds := []latencyBuild{
+		{job: "a", cluster: "build01", pending: time.Minute, started: 3 * time.Minute, completed: 13 * time.Minute},
+		{job: "a", cluster: "build01", pending: 2 * time.Minute, started: 6 * time.Minute, completed: 26 * time.Minute},
+		// Not yet seen pending, so neither queued nor pending.
+		{job: "a", cluster: "build02", started: 5 * time.Minute, completed: 35 * time.Minute},
+		// Still running.
+		{job: "b", cluster: "build01", pending: 30 * time.Second, started: time.Minute},
+		// Created before --from.
+		{job: "a", cluster: "build01", age: 48 * time.Hour, pending: time.Hour, started: 2 * time.Hour, completed: 3 * time.Hour},
+	}
+
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "prow.db")
+	conn, err := db.Open(ctx, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, build := range builds {
+		created := now.Add(-time.Hour - build.age)
+		at := func(offset time.Duration, layout string) interface{} {
+			if offset == 0 {
+				return nil
+			}
+			return created.Add(offset).Format(layout)
+		}
+		err := sqlitex.Execute(conn, `insert into jobs (id, name, result, build_id, cluster, created, pending_time, started, completion_time)
+values ($id, $name, 'success', $build_id, $cluster, $created, $pending_time, $started, $completion_time)`, &sqlitex.ExecOptions{
+			Named: map[string]interface{}{
+				"$id":              fmt.Sprintf("%s/%d", build.job, i),
+				"$name":            build.job,
+				"$build_id":        fmt.Sprint(i),
+				"$cluster":         build.cluster,
+				"$created":         created.Format(time.RFC3339),
+				"$pending_time":    at(build.pending, time.RFC3339),
+				"$started":         at(build.started, db.StartedLayout),
+				"$completion_time": at(build.completed, time.RFC3339),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn.Close()
+
+	tests := []struct {
+		name    string
+		groupBy []string
+		// want are the builds and the queue, pending and run P50 and P90 of
+		// each group.
+		want map[string]string
+	}{
+		{
+			name:    "job",
+			groupBy: []string{"job"},
+			want: map[string]string{
+				"a": "3 1m0s 2m0s 2m0s 4m0s 20m0s 30m0s",
+				"b": "1 30s 30s 30s 30s - -",
+			},
+		},
+		{
+			name:    "cluster",
+			groupBy: []string{"cluster"},
+			want: map[string]string{
+				"build01": "3 1m0s 2m0s 2m0s 4m0s 10m0s 20m0s",
+				"build02": "1 - - - - 30m0s 30m0s",
+			},
+		},
+		{
+			name:    "job and cluster",
+			groupBy: []string{"job", "cluster"},
+			want: map[string]string{
+				"a\tbuild01": "2 1m0s 2m0s 2m0s 4m0s 10m0s 20m0s",
+				"a\tbuild02": "1 - - - - 30m0s 30m0s",
+				"b\tbuild01": "1 30s 30s 30s 30s - -",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := db.OpenReadOnly(ctx, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			groups, err := readLatencies(conn, latencyOptions{From: 24 * time.Hour, GroupBy: tt.groupBy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for key, group := range groups {
+				got[key] = fmt.Sprintf("%d %s %s %s %s %s %s", group.builds,
+					percentile(group.queue, 50), percentile(group.queue, 90),
+					percentile(group.pending, 50), percentile(group.pending, 90),
+					percentile(group.run, 50), percentile(group.run, 90))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readLatencies() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,18 +1,49 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ironcladlou/prowdb/cmd/cache"
 	"github.com/ironcladlou/prowdb/cmd/db"
+	"github.com/ironcladlou/prowdb/cmd/exit"
 	"github.com/ironcladlou/prowdb/cmd/hist"
+	"github.com/ironcladlou/prowdb/cmd/jobs"
+	"github.com/ironcladlou/prowdb/cmd/sample"
+	"github.com/ironcladlou/prowdb/cmd/stats"
 	"github.com/spf13/cobra"
 )
 
 func main() {
 	var root = &cobra.Command{Use: "prowdb"}
 
+	// Errors returned before a command runs come from parsing the command
+	// line, and are the only ones worth showing usage for.
+	var parsed bool
+	root.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		parsed = true
+		cmd.SilenceUsage = true
+	}
+
+	root.AddCommand(cache.NewCommand())
 	root.AddCommand(db.NewCommand())
 	root.AddCommand(hist.NewCommand())
+	root.AddCommand(jobs.NewCommand())
+	root.AddCommand(sample.NewCommand())
+	root.AddCommand(stats.NewCommand())
 
-	if err := root.Execute(); err != nil {
-		panic(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := root.ExecuteContext(ctx)
+	interrupted := ctx.Err() != nil
+	stop()
+	switch {
+	case err == nil:
+	case interrupted:
+		os.Exit(exit.Interrupted)
+	case !parsed:
+		err = exit.Usage(err)
 	}
+	os.Exit(exit.Code(err))
 }
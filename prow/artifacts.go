@@ -0,0 +1,120 @@
+package prow
+
+import (
+	"context"
+	"io"
+	"mime"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ironcladlou/prowdb/prow/internal"
+)
+
+// Artifacts reads the files builds upload alongside their metadata. Errors
+// are *BuildErrors naming the build.
+type Artifacts struct {
+	bucket internal.Bucket
+}
+
+// OpenArtifacts opens the bucket described by storage for reading artifacts.
+func OpenArtifacts(ctx context.Context, storage StorageOptions) (*Artifacts, error) {
+	bucket, err := openBucket(ctx, storage)
+	if err != nil {
+		return nil, err
+	}
+	return &Artifacts{bucket: bucket}, nil
+}
+
+// List returns the names of the build's files under dir, relative to the
+// build's directory.
+func (a *Artifacts) List(ctx context.Context, build Build, dir string) ([]string, error) {
+	keys, err := internal.ListKeys(ctx, a.bucket, path.Join(build.Prefix, dir))
+	if err != nil {
+		return nil, buildError(build, err)
+	}
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, strings.TrimPrefix(key, build.Prefix+"/"))
+	}
+	return names, nil
+}
+
+// Glob returns the names of the build's files under dir whose base name
+// matches pattern, relative to the build's directory.
+func (a *Artifacts) Glob(ctx context.Context, build Build, dir, pattern string) ([]string, error) {
+	names, err := a.List(ctx, build, dir)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, name := range names {
+		if ok, _ := filepath.Match(pattern, path.Base(name)); ok {
+			matches = append(matches, name)
+		}
+	}
+	return matches, nil
+}
+
+// Read reads the build's file with the given name, relative to the build's
+// directory.
+func (a *Artifacts) Read(ctx context.Context, build Build, name string) ([]byte, error) {
+	data, err := internal.ReadObject(ctx, a.bucket, path.Join(build.Prefix, name))
+	if err != nil {
+		return nil, buildError(build, err)
+	}
+	return data, nil
+}
+
+// Open streams the build's file with the given name, relative to the build's
+// directory.
+func (a *Artifacts) Open(ctx context.Context, build Build, name string) (io.ReadCloser, error) {
+	rc, err := internal.OpenObject(ctx, a.bucket, path.Join(build.Prefix, name))
+	if err != nil {
+		return nil, buildError(build, err)
+	}
+	return rc, nil
+}
+
+// Artifact is a file uploaded by a build.
+type Artifact struct {
+	// Name is relative to the build's directory.
+	Name string
+	Size int64
+	// ContentType is inferred from the name's extension, as the bucket
+	// doesn't report it. It's empty for unknown extensions.
+	ContentType     string
+	ContentEncoding string
+}
+
+// Inventory lists every file the build uploaded, with its size.
+func (a *Artifacts) Inventory(ctx context.Context, build Build) ([]Artifact, error) {
+	names, err := a.List(ctx, build, "")
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []Artifact
+	for _, name := range names {
+		attrs, err := internal.GetAttributes(ctx, a.bucket, path.Join(build.Prefix, name))
+		if err != nil {
+			if Classify(err) == ErrorNotFound {
+				// removed since it was listed
+				continue
+			}
+			return nil, buildError(build, err)
+		}
+		artifacts = append(artifacts, Artifact{
+			Name:            name,
+			Size:            attrs.Size,
+			ContentType:     mime.TypeByExtension(path.Ext(name)),
+			ContentEncoding: attrs.ContentEncoding,
+		})
+	}
+	return artifacts, nil
+}
+
+func buildError(build Build, err error) error {
+	id, _ := strconv.ParseInt(build.ID, 10, 64)
+	return &BuildError{Job: build.Job, Root: path.Dir(build.Prefix), BuildID: id, Err: err}
+}
@@ -0,0 +1,115 @@
+package prow
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/ironcladlou/prowdb/prow/internal"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	DefaultStorageProvider = "gs"
+	DefaultBucket          = "origin-ci-test"
+	DefaultLogsPrefix      = "logs"
+	DefaultPRLogsPrefix    = "pr-logs/directory"
+
+	DefaultRetries      = 5
+	DefaultRetryBackoff = time.Second
+	DefaultQPS          = 100
+)
+
+// FileStorageProvider names buckets mirrored to a local directory.
+const FileStorageProvider = internal.FileStorageProvider
+
+// StorageOptions describe the bucket a Prow deployment uploads builds to.
+type StorageOptions struct {
+	// Provider is the storage provider, e.g. gs or s3.
+	Provider string `json:"provider,omitempty"`
+	Bucket   string `json:"bucket,omitempty"`
+	// LogsPrefix holds postsubmit and periodic builds.
+	LogsPrefix string `json:"logsPrefix,omitempty"`
+	// PRLogsPrefix holds symlinks to presubmit and batch builds.
+	PRLogsPrefix string `json:"prLogsPrefix,omitempty"`
+
+	GCSCredentialsFile string `json:"gcsCredentialsFile,omitempty"`
+	S3CredentialsFile  string `json:"s3CredentialsFile,omitempty"`
+
+	// Retries is how many times a read failing with a transient error is
+	// retried, starting RetryBackoff after the first attempt.
+	Retries      int           `json:"-"`
+	RetryBackoff time.Duration `json:"-"`
+	// QPS limits the rate of reads from the bucket.
+	QPS float64 `json:"-"`
+
+	// CacheDir holds a local cache of bucket objects. Caching is disabled if
+	// it's empty.
+	CacheDir string `json:"cacheDir,omitempty"`
+}
+
+// AddFlags binds the options to flags.
+func (o *StorageOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.Provider, "storage-provider", "", DefaultStorageProvider, "storage provider of the bucket holding builds (gs, s3, or file for a local directory given as --bucket)")
+	flags.StringVarP(&o.Bucket, "bucket", "", DefaultBucket, "bucket holding builds")
+	flags.StringVarP(&o.LogsPrefix, "logs-prefix", "", DefaultLogsPrefix, "bucket prefix holding postsubmit and periodic builds")
+	flags.StringVarP(&o.PRLogsPrefix, "pr-logs-prefix", "", DefaultPRLogsPrefix, "bucket prefix holding presubmit and batch build symlinks")
+	flags.StringVarP(&o.GCSCredentialsFile, "gcs-credentials-file", "", "", "GCS credentials file")
+	flags.StringVarP(&o.S3CredentialsFile, "s3-credentials-file", "", "", "S3 credentials file")
+	flags.IntVarP(&o.Retries, "retries", "", DefaultRetries, "times to retry a bucket read that fails with a transient error")
+	flags.DurationVarP(&o.RetryBackoff, "retry-backoff", "", DefaultRetryBackoff, "delay before the first retry of a bucket read, doubled for each further retry")
+	flags.Float64VarP(&o.QPS, "qps", "", DefaultQPS, "maximum bucket reads per second, or 0 for no limit")
+	flags.StringVarP(&o.CacheDir, "cache-dir", "", "", "directory to cache bucket files in, keyed by their generation")
+}
+
+// Config is the contents of the file given with --config. It describes a
+// Prow deployment so its settings don't have to be repeated as flags.
+type Config struct {
+	BaseURL string         `json:"baseURL,omitempty"`
+	Storage StorageOptions `json:"storage,omitempty"`
+}
+
+// LoadConfig reads a YAML config file.
+func LoadConfig(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	return config, nil
+}
+
+// Complete fills in options from the file named by --config. Flags given on
+// the command line take precedence over the file.
+func (o *SourceOptions) Complete(flags *pflag.FlagSet) error {
+	if o.ConfigFile == "" {
+		return nil
+	}
+	config, err := LoadConfig(o.ConfigFile)
+	if err != nil {
+		return err
+	}
+	for flag, value := range map[string]struct {
+		target *string
+		value  string
+	}{
+		"base-url":             {&o.BaseURL, config.BaseURL},
+		"storage-provider":     {&o.Storage.Provider, config.Storage.Provider},
+		"bucket":               {&o.Storage.Bucket, config.Storage.Bucket},
+		"logs-prefix":          {&o.Storage.LogsPrefix, config.Storage.LogsPrefix},
+		"pr-logs-prefix":       {&o.Storage.PRLogsPrefix, config.Storage.PRLogsPrefix},
+		"gcs-credentials-file": {&o.Storage.GCSCredentialsFile, config.Storage.GCSCredentialsFile},
+		"s3-credentials-file":  {&o.Storage.S3CredentialsFile, config.Storage.S3CredentialsFile},
+		"cache-dir":            {&o.Storage.CacheDir, config.Storage.CacheDir},
+	} {
+		if value.value != "" && !flags.Changed(flag) {
+			*value.target = value.value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// ListKeys lists every key under prefix, including those in nested
+// "directories".
+func ListKeys(ctx context.Context, bucket Bucket, prefix string) ([]string, error) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return bucket.listAll(ctx, prefix)
+}
+
+// ReadObject reads the object at key.
+func ReadObject(ctx context.Context, bucket Bucket, key string) ([]byte, error) {
+	return bucket.readObject(ctx, key)
+}
+
+// OpenObject streams the object at key.
+func OpenObject(ctx context.Context, bucket Bucket, key string) (io.ReadCloser, error) {
+	return bucket.readRange(ctx, key, 0, -1)
+}
+
+// GetAttributes reads the attributes of the object at key.
+func GetAttributes(ctx context.Context, bucket Bucket, key string) (ObjectAttributes, error) {
+	return bucket.attributes(ctx, key)
+}
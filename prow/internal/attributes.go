@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/sirupsen/logrus"
+	"gocloud.dev/blob"
+	"google.golang.org/api/option"
+	"k8s.io/test-infra/prow/io/providers"
+)
+
+// AttributesReader reads the attributes of the objects in a bucket. The
+// opener doesn't report object generations, which the cache is keyed by, so
+// attributes are read with the storage provider's own client instead.
+type AttributesReader interface {
+	Attributes(ctx context.Context, key string) (ObjectAttributes, error)
+}
+
+// OpenAttributes returns an AttributesReader for the bucket called name at
+// storageProvider, authenticated like the opener. Only GCS and S3 report a
+// generation for each object.
+func OpenAttributes(ctx context.Context, storageProvider, name, gcsCredentialsFile, s3CredentialsFile string) (AttributesReader, error) {
+	switch storageProvider {
+	case providers.GS:
+		client, err := newGCSClient(ctx, gcsCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		return gcsAttributes{client.Bucket(name)}, nil
+	case providers.S3:
+		var credentials []byte
+		if s3CredentialsFile != "" {
+			var err error
+			credentials, err = ioutil.ReadFile(s3CredentialsFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		bucket, err := providers.GetBucket(ctx, credentials, fmt.Sprintf("%s://%s", storageProvider, name))
+		if err != nil {
+			return nil, err
+		}
+		return s3Attributes{bucket}, nil
+	}
+	return nil, fmt.Errorf("reading object generations from storage provider %q isn't supported", storageProvider)
+}
+
+// newGCSClient authenticates like the opener: with the credentials file if
+// one is given, else the default credentials, else anonymously.
+func newGCSClient(ctx context.Context, credentialsFile string) (*storage.Client, error) {
+	if credentialsFile != "" {
+		return storage.NewClient(ctx, option.WithCredentialsFile(credentialsFile))
+	}
+	client, err := storage.NewClient(ctx)
+	if err == nil {
+		return client, nil
+	}
+	logrus.WithError(err).Debug("Cannot load application default gcp credentials, falling back to anonymous client")
+	return storage.NewClient(ctx, option.WithoutAuthentication())
+}
+
+type gcsAttributes struct {
+	bucket *storage.BucketHandle
+}
+
+func (a gcsAttributes) Attributes(ctx context.Context, key string) (ObjectAttributes, error) {
+	attrs, err := a.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		return ObjectAttributes{}, err
+	}
+	return ObjectAttributes{
+		Size:            attrs.Size,
+		ContentEncoding: attrs.ContentEncoding,
+		Generation:      strconv.FormatInt(attrs.Generation, 10),
+	}, nil
+}
+
+// s3Attributes use an object's ETag as its generation. S3 has no generation
+// numbers, but the ETag changes whenever an object is rewritten.
+type s3Attributes struct {
+	bucket *blob.Bucket
+}
+
+func (a s3Attributes) Attributes(ctx context.Context, key string) (ObjectAttributes, error) {
+	attrs, err := a.bucket.Attributes(ctx, key)
+	if err != nil {
+		return ObjectAttributes{}, err
+	}
+	var head s3.HeadObjectOutput
+	if !attrs.As(&head) || aws.StringValue(head.ETag) == "" {
+		return ObjectAttributes{}, fmt.Errorf("object %s has no ETag", key)
+	}
+	return ObjectAttributes{
+		Size:            attrs.Size,
+		ContentEncoding: attrs.ContentEncoding,
+		Generation:      aws.StringValue(head.ETag),
+	}, nil
+}
@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Cache stores bucket objects on local disk, keyed by the storage provider,
+// bucket name, object key and object version. A rewritten object has a new
+// version, so it's never served from the cache stale.
+type Cache struct {
+	dir string
+}
+
+// NewCache returns a cache stored under dir, which is created as needed.
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+func (c *Cache) objectsDir() string {
+	return filepath.Join(c.dir, "objects")
+}
+
+func (c *Cache) path(provider, bucket, key, version string) string {
+	sum := sha256.Sum256([]byte(provider + "\x00" + bucket + "\x00" + key + "\x00" + version))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.objectsDir(), name[:2], name)
+}
+
+// get returns a cached object, marking it used.
+func (c *Cache) get(provider, bucket, key, version string) ([]byte, bool) {
+	p := c.path(provider, bucket, key, version)
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return data, true
+}
+
+// put stores an object. The object is written to a temporary file first so
+// concurrent readers never see part of it.
+func (c *Cache) put(provider, bucket, key, version string, data []byte) error {
+	p := c.path(provider, bucket, key, version)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// CacheStats summarize the objects in a cache.
+type CacheStats struct {
+	Objects int
+	Bytes   int64
+	// Oldest and Newest are when the least and most recently used objects
+	// were last used.
+	Oldest time.Time
+	Newest time.Time
+}
+
+func (s *CacheStats) add(info fs.FileInfo) {
+	s.Objects++
+	s.Bytes += info.Size()
+	if s.Oldest.IsZero() || info.ModTime().Before(s.Oldest) {
+		s.Oldest = info.ModTime()
+	}
+	if info.ModTime().After(s.Newest) {
+		s.Newest = info.ModTime()
+	}
+}
+
+type cachedObject struct {
+	path string
+	info fs.FileInfo
+}
+
+func (c *Cache) objects() ([]cachedObject, error) {
+	var objects []cachedObject
+	err := filepath.WalkDir(c.objectsDir(), func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, cachedObject{p, info})
+		return nil
+	})
+	return objects, err
+}
+
+// Stats summarizes the objects in the cache.
+func (c *Cache) Stats() (CacheStats, error) {
+	var stats CacheStats
+	objects, err := c.objects()
+	if err != nil {
+		return stats, err
+	}
+	for _, object := range objects {
+		stats.add(object.info)
+	}
+	return stats, nil
+}
+
+// Prune removes objects not used for maxAge, then the least recently used
+// objects until the cache holds no more than maxBytes. A zero limit isn't
+// applied. It returns a summary of the objects removed.
+func (c *Cache) Prune(maxAge time.Duration, maxBytes int64) (CacheStats, error) {
+	var removed CacheStats
+	objects, err := c.objects()
+	if err != nil {
+		return removed, err
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].info.ModTime().Before(objects[j].info.ModTime())
+	})
+	var total int64
+	for _, object := range objects {
+		total += object.info.Size()
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, object := range objects {
+		expired := maxAge > 0 && object.info.ModTime().Before(cutoff)
+		oversized := maxBytes > 0 && total > maxBytes
+		if !expired && !oversized {
+			break
+		}
+		if err := os.Remove(object.path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		total -= object.info.Size()
+		removed.add(object.info)
+	}
+	return removed, nil
+}
+
+// cachingBucket wraps a storageBucket to serve objects read whole from a
+// Cache. Streamed reads, listings and attributes always go to the bucket.
+type cachingBucket struct {
+	storageBucket
+	cache *Cache
+}
+
+func newCachingBucket(bucket storageBucket, cache *Cache) cachingBucket {
+	return cachingBucket{storageBucket: bucket, cache: cache}
+}
+
+// readObject reads the object's attributes and serves it from the cache if
+// its current version is cached, so only a miss reads its content from the
+// bucket. An object rewritten between reading its attributes and its content
+// is cached under its old generation, which isn't looked up again, unless its
+// size changed, in which case it isn't cached at all.
+func (bucket cachingBucket) readObject(ctx context.Context, key string) ([]byte, error) {
+	provider, name := bucket.getStorageProvider(), bucket.getName()
+	attrs, err := bucket.storageBucket.attributes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if attrs.Generation == "" {
+		return nil, fmt.Errorf("caching object %s: the %s bucket doesn't report object generations", key, provider)
+	}
+	version := attrs.version()
+	if data, ok := bucket.cache.get(provider, name, key, version); ok {
+		return data, nil
+	}
+	data, err := bucket.storageBucket.readObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	// The size of an object stored compressed is that of its compressed
+	// content, which the reader decompresses.
+	if attrs.ContentEncoding == "" && int64(len(data)) != attrs.Size {
+		return data, nil
+	}
+	if err := bucket.cache.put(provider, name, key, version, data); err != nil {
+		logrus.WithError(err).Warnf("failed to cache %s", key)
+	}
+	return data, nil
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCachingBucketReadObject(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeBucket()
+	cache := NewCache(t.TempDir())
+	bucket := newCachingBucket(fake, cache)
+
+	// reads reads key twice and returns how many times the fake bucket read
+	// its content.
+	reads := func(key, want string) int {
+		t.Helper()
+		before := fake.readCount()
+		for i := 0; i < 2; i++ {
+			data, err := bucket.readObject(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != want {
+				t.Errorf("%s = %q, want %q", key, data, want)
+			}
+		}
+		return fake.readCount() - before
+	}
+
+	fake.write("logs/job/1/finished.json", `{"result":"SUCCESS"}`)
+	if n := reads("logs/job/1/finished.json", `{"result":"SUCCESS"}`); n != 1 {
+		t.Errorf("object read from the bucket %d times, want 1", n)
+	}
+
+	// A rewritten object has a new generation, even if its size is the same.
+	fake.write("logs/job/1/finished.json", `{"result":"FAILURE"}`)
+	if n := reads("logs/job/1/finished.json", `{"result":"FAILURE"}`); n != 1 {
+		t.Errorf("rewritten object read from the bucket %d times, want 1", n)
+	}
+
+	// The files of a build are cached whether or not it has finished.
+	fake.write("logs/job/2/started.json", `{"timestamp":1}`)
+	if n := reads("logs/job/2/started.json", `{"timestamp":1}`); n != 1 {
+		t.Errorf("file of a running build read from the bucket %d times, want 1", n)
+	}
+
+	// A pruned object is read from the bucket again.
+	if _, err := cache.Prune(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := reads("logs/job/2/started.json", `{"timestamp":1}`); n != 1 {
+		t.Errorf("pruned object read from the bucket %d times, want 1", n)
+	}
+
+	if _, err := bucket.readObject(ctx, "logs/job/3/finished.json"); err == nil {
+		t.Error("expected an error reading a missing object")
+	}
+}
+
+func TestCachingBucketNoGenerations(t *testing.T) {
+	fake := newFakeBucket()
+	fake.write("logs/job/1/finished.json", "{}")
+	bucket := newCachingBucket(noGenerations{fake}, NewCache(t.TempDir()))
+	if _, err := bucket.readObject(context.Background(), "logs/job/1/finished.json"); err == nil {
+		t.Error("expected an error caching objects of a bucket without generations")
+	}
+}
+
+// noGenerations is a bucket that reports no object generations, like one read
+// with the opener alone.
+type noGenerations struct {
+	*fakeBucket
+}
+
+func (b noGenerations) attributes(ctx context.Context, key string) (ObjectAttributes, error) {
+	attrs, err := b.fakeBucket.attributes(ctx, key)
+	attrs.Generation = ""
+	return attrs, err
+}
+
+func TestCachePrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		maxAge   time.Duration
+		maxBytes int64
+		// removed are the ages in hours of the objects removed.
+		removed []int
+	}{
+		{name: "no limits"},
+		{name: "max age", maxAge: 36 * time.Hour, removed: []int{72, 48}},
+		{name: "max bytes", maxBytes: 25, removed: []int{72, 48}},
+		{name: "max bytes kept", maxBytes: 40},
+		{name: "both", maxAge: 60 * time.Hour, maxBytes: 15, removed: []int{72, 48, 24}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewCache(t.TempDir())
+			// Four 10 byte objects, last used 0, 24, 48 and 72 hours ago.
+			ages := map[string]int{}
+			for _, age := range []int{0, 24, 48, 72} {
+				key := strconv.Itoa(age)
+				if err := cache.put("fake", "fake", key, "1", []byte("0123456789")); err != nil {
+					t.Fatal(err)
+				}
+				used := now.Add(-time.Duration(age) * time.Hour)
+				p := cache.path("fake", "fake", key, "1")
+				if err := os.Chtimes(p, used, used); err != nil {
+					t.Fatal(err)
+				}
+				ages[p] = age
+			}
+
+			removed, err := cache.Prune(tt.maxAge, tt.maxBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed.Objects != len(tt.removed) || removed.Bytes != int64(10*len(tt.removed)) {
+				t.Errorf("removed %d objects of %d bytes, want %d", removed.Objects, removed.Bytes, len(tt.removed))
+			}
+			gone := map[int]bool{}
+			for _, age := range tt.removed {
+				gone[age] = true
+			}
+			for p, age := range ages {
+				_, err := os.Stat(p)
+				if exists := err == nil; exists == gone[age] {
+					t.Errorf("object used %dh ago: exists = %v", age, exists)
+				}
+			}
+			stats, err := cache.Stats()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := 4 - len(tt.removed); stats.Objects != want {
+				t.Errorf("%d objects left, want %d", stats.Objects, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	pkgio "k8s.io/test-infra/prow/io"
+)
+
+// fakeBucket is an in-memory storageBucket. Each write of an object gives it
+// a new generation, and reads and listings are counted.
+type fakeBucket struct {
+	layout Layout
+
+	mu          sync.Mutex
+	objects     map[string][]byte
+	generations map[string]int
+	reads       int
+	lists       int
+}
+
+func newFakeBucket() *fakeBucket {
+	return &fakeBucket{
+		layout:      Layout{LogsPrefix: "logs"},
+		objects:     map[string][]byte{},
+		generations: map[string]int{},
+	}
+}
+
+func (b *fakeBucket) write(key, data string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key] = []byte(data)
+	b.generations[key]++
+}
+
+func (b *fakeBucket) readCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reads
+}
+
+func (b *fakeBucket) listCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lists
+}
+
+func (b *fakeBucket) getName() string            { return "fake" }
+func (b *fakeBucket) getStorageProvider() string { return "fake" }
+func (b *fakeBucket) getLayout() Layout          { return b.layout }
+
+func (b *fakeBucket) listSubDirs(ctx context.Context, prefix string) ([]string, error) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lists++
+	seen := map[string]bool{}
+	dirs := []string{}
+	for key := range b.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := key[len(prefix):]
+		i := strings.Index(rest, "/")
+		if i < 0 {
+			continue
+		}
+		dir := prefix + rest[:i+1]
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+func (b *fakeBucket) listAll(ctx context.Context, prefix string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lists++
+	keys := []string{}
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (b *fakeBucket) readObject(ctx context.Context, key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[key]
+	if !ok {
+		return nil, pkgio.ErrNotFoundTest
+	}
+	b.reads++
+	return append([]byte{}, data...), nil
+}
+
+func (b *fakeBucket) readRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	data, err := b.readObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *fakeBucket) attributes(ctx context.Context, key string) (ObjectAttributes, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[key]
+	if !ok {
+		return ObjectAttributes{}, pkgio.ErrNotFoundTest
+	}
+	return ObjectAttributes{Size: int64(len(data)), Generation: strconv.Itoa(b.generations[key])}, nil
+}
@@ -28,9 +28,12 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	v1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	pkgio "k8s.io/test-infra/prow/io"
 	"k8s.io/test-infra/prow/io/providers"
@@ -38,13 +41,9 @@ import (
 )
 
 const (
-	resultsPerPage  = 20
 	idParam         = "buildId"
 	latestBuildFile = "latest-build.txt"
 
-	// ** Job history assumes the GCS layout specified here:
-	// https://github.com/kubernetes/test-infra/tree/master/gubernator#gcs-bucket-layout
-	logsPrefix     = gcs.NonPRLogs
 	spyglassPrefix = "/view"
 	emptyID        = int64(-1) // indicates no build id was specified
 )
@@ -54,42 +53,104 @@ var (
 )
 
 type BuildData struct {
-	index        int
-	jobName      string
-	prefix       string
+	index int
+	// Prefix is the bucket key of the directory the build's files are stored
+	// under, without a trailing slash.
+	Prefix       string
 	SpyglassLink string
 	ID           string
 	Started      time.Time
 	Duration     time.Duration
 	Result       string
-	commitHash   string
-	ProwJob      v1.ProwJob
+	// CommitHash is the commit tested, or empty if it isn't known.
+	CommitHash string
+	// Repos, RepoCommit and StartedMetadata are read from started.json.
+	Repos           map[string]string
+	RepoCommit      string
+	StartedMetadata map[string]interface{}
+	// FinishedMetadata is read from finished.json.
+	FinishedMetadata map[string]interface{}
+	ProwJob          v1.ProwJob
+}
+
+// Layout describes where a Prow deployment keeps builds in its bucket.
+// Job history assumes the GCS layout specified here:
+// https://github.com/kubernetes/test-infra/tree/master/gubernator#gcs-bucket-layout
+type Layout struct {
+	// LogsPrefix is the prefix under which builds are stored directly as
+	// <prefix>/<job>/<build>. Jobs anywhere else are assumed to index their
+	// builds with <root>/<build>.txt symlinks.
+	LogsPrefix string
+}
+
+// DefaultLayout is the layout used by upstream Prow.
+var DefaultLayout = Layout{LogsPrefix: gcs.NonPRLogs}
+
+// storesBuilds reports whether builds are stored directly under root rather
+// than through symlinks.
+func (l Layout) storesBuilds(root string) bool {
+	return strings.HasPrefix(root, strings.TrimSuffix(l.LogsPrefix, "/")+"/")
 }
 
 // storageBucket is an abstraction for unit testing
 type storageBucket interface {
 	getName() string
 	getStorageProvider() string
+	getLayout() Layout
 	listSubDirs(ctx context.Context, prefix string) ([]string, error)
 	listAll(ctx context.Context, prefix string) ([]string, error)
 	readObject(ctx context.Context, key string) ([]byte, error)
+	// readRange streams length bytes of the object at key starting at
+	// offset, or the rest of the object if length is negative.
+	readRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	attributes(ctx context.Context, key string) (ObjectAttributes, error)
+}
+
+// ObjectAttributes describe a stored object.
+type ObjectAttributes struct {
+	Size            int64
+	ContentEncoding string
+	// Generation identifies the content of the object. It changes whenever
+	// the object is rewritten. The opener doesn't report it.
+	Generation string
+}
+
+// version identifies the content of an object for the cache.
+func (attrs ObjectAttributes) version() string {
+	return fmt.Sprintf("%d-%s", attrs.Size, attrs.Generation)
+}
+
+// Bucket is the storage a Prow deployment uploads job history to.
+type Bucket struct {
+	storageBucket
+}
+
+// NewBucket returns the bucket called name at storageProvider, read with
+// opener. For the file storage provider, name is instead a local directory
+// laid out like a bucket and opener isn't used. Reads are throttled and
+// retried according to retry, and served from cache if it isn't nil, in which
+// case attributes are read with attrs to know the generation of each object.
+func NewBucket(opener pkgio.Opener, attrs AttributesReader, storageProvider, name string, layout Layout, retry RetryOptions, cache *Cache) Bucket {
+	var bucket storageBucket = blobStorageBucket{name, storageProvider, layout, opener, attrs}
+	if storageProvider == FileStorageProvider {
+		bucket = localStorageBucket{name, layout}
+	}
+	bucket = newRetryingBucket(bucket, retry)
+	if cache != nil {
+		bucket = newCachingBucket(bucket, cache)
+	}
+	return Bucket{bucket}
 }
 
 // blobStorageBucket is our real implementation of storageBucket
 type blobStorageBucket struct {
 	name            string
 	storageProvider string
+	layout          Layout
 	pkgio.Opener
-}
-
-type jobHistoryTemplate struct {
-	OlderLink    string
-	NewerLink    string
-	LatestLink   string
-	Name         string
-	ResultsShown int
-	ResultsTotal int
-	Builds       []BuildData
+	// attrs reads object attributes instead of the opener, which doesn't
+	// report generations, if it isn't nil.
+	attrs AttributesReader
 }
 
 func (bucket blobStorageBucket) readObject(ctx context.Context, key string) ([]byte, error) {
@@ -101,6 +162,29 @@ func (bucket blobStorageBucket) readObject(ctx context.Context, key string) ([]b
 	return ioutil.ReadAll(rc)
 }
 
+func (bucket blobStorageBucket) readRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := bucket.Opener.RangeReader(ctx, fmt.Sprintf("%s://%s/%s", bucket.storageProvider, bucket.name, key), offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("creating range reader for object %s: %w", key, err)
+	}
+	return rc, nil
+}
+
+func (bucket blobStorageBucket) attributes(ctx context.Context, key string) (ObjectAttributes, error) {
+	if bucket.attrs != nil {
+		attrs, err := bucket.attrs.Attributes(ctx, key)
+		if err != nil {
+			return ObjectAttributes{}, fmt.Errorf("reading attributes of object %s: %w", key, err)
+		}
+		return attrs, nil
+	}
+	attrs, err := bucket.Opener.Attributes(ctx, fmt.Sprintf("%s://%s/%s", bucket.storageProvider, bucket.name, key))
+	if err != nil {
+		return ObjectAttributes{}, fmt.Errorf("reading attributes of object %s: %w", key, err)
+	}
+	return ObjectAttributes{Size: attrs.Size, ContentEncoding: attrs.ContentEncoding}, nil
+}
+
 func (bucket blobStorageBucket) getName() string {
 	return bucket.name
 }
@@ -109,11 +193,17 @@ func (bucket blobStorageBucket) getStorageProvider() string {
 	return bucket.storageProvider
 }
 
-func readLatestBuild(ctx context.Context, bucket storageBucket, root string) (int64, error) {
+func (bucket blobStorageBucket) getLayout() Layout {
+	return bucket.layout
+}
+
+// LatestBuild reads the ID of the newest build under root. It returns an
+// error satisfying pkgio.IsNotExist if the job has no history there.
+func LatestBuild(ctx context.Context, bucket Bucket, root string) (int64, error) {
 	key := path.Join(root, latestBuildFile)
 	data, err := bucket.readObject(ctx, key)
 	if err != nil {
-		return -1, fmt.Errorf("failed to read %s: %v", key, err)
+		return -1, err
 	}
 	n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
 	if err != nil {
@@ -122,13 +212,38 @@ func readLatestBuild(ctx context.Context, bucket storageBucket, root string) (in
 	return n, nil
 }
 
+// ReadProwJob reads the ProwJob of a build under root, following the
+// symlink of a build indexed outside the logs prefix.
+func ReadProwJob(ctx context.Context, bucket Bucket, root string, buildID int64) (v1.ProwJob, error) {
+	var prowJob v1.ProwJob
+	key, err := getPath(ctx, bucket, root, strconv.FormatInt(buildID, 10), "prowjob.json")
+	if err != nil {
+		return prowJob, err
+	}
+	err = readJSON(ctx, bucket, key, &prowJob)
+	return prowJob, err
+}
+
+// ListJobs lists the names of the jobs with history under prefix.
+func ListJobs(ctx context.Context, bucket Bucket, prefix string) ([]string, error) {
+	dirs, err := bucket.listSubDirs(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directories: %w", err)
+	}
+	jobs := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		jobs = append(jobs, path.Base(dir))
+	}
+	return jobs, nil
+}
+
 // resolve symlinks into the actual log directory for a particular test run, e.g.:
 // * input:  gs://prow-artifacts/pr-logs/pull/cluster-api-provider-openstack/1687/bazel-build/1248207834168954881
 // * output: pr-logs/pull/cluster-api-provider-openstack/1687/bazel-build/1248207834168954881
-func (bucket blobStorageBucket) resolveSymLink(ctx context.Context, symLink string) (string, error) {
+func resolveSymLink(ctx context.Context, bucket storageBucket, symLink string) (string, error) {
 	data, err := bucket.readObject(ctx, symLink)
 	if err != nil {
-		return "", fmt.Errorf("failed to read %s: %v", symLink, err)
+		return "", fmt.Errorf("failed to read %s: %w", symLink, err)
 	}
 	// strip gs://<bucket-name> from global address `u`
 	u := strings.TrimSpace(string(data))
@@ -139,22 +254,18 @@ func (bucket blobStorageBucket) resolveSymLink(ctx context.Context, symLink stri
 	return strings.TrimPrefix(parsedURL.Path, "/"), nil
 }
 
-func (bucket blobStorageBucket) spyglassLink(ctx context.Context, root, id string) (string, error) {
-	p, err := bucket.getPath(ctx, root, id, "")
-	if err != nil {
-		return "", fmt.Errorf("failed to get path: %v", err)
-	}
-	return path.Join(spyglassPrefix, bucket.storageProvider, bucket.name, p), nil
+func spyglassLink(bucket storageBucket, dir string) string {
+	return path.Join(spyglassPrefix, bucket.getStorageProvider(), bucket.getName(), dir)
 }
 
-func (bucket blobStorageBucket) getPath(ctx context.Context, root, id, fname string) (string, error) {
-	if strings.HasPrefix(root, logsPrefix) {
+func getPath(ctx context.Context, bucket storageBucket, root, id, fname string) (string, error) {
+	if bucket.getLayout().storesBuilds(root) {
 		return path.Join(root, id, fname), nil
 	}
 	symLink := path.Join(root, id+".txt")
-	dir, err := bucket.resolveSymLink(ctx, symLink)
+	dir, err := resolveSymLink(ctx, bucket, symLink)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve sym link: %v", err)
+		return "", fmt.Errorf("failed to resolve sym link: %w", err)
 	}
 	return path.Join(dir, fname), nil
 }
@@ -163,11 +274,11 @@ func (bucket blobStorageBucket) getPath(ctx context.Context, root, id, fname str
 func readJSON(ctx context.Context, bucket storageBucket, key string, data interface{}) error {
 	rawData, err := bucket.readObject(ctx, key)
 	if err != nil {
-		return fmt.Errorf("failed to read %s: %v", key, err)
+		return fmt.Errorf("failed to read %s: %w", key, err)
 	}
 	err = json.Unmarshal(rawData, &data)
 	if err != nil {
-		return fmt.Errorf("failed to parse %s: %v", key, err)
+		return &ObjectError{Key: key, Class: ErrorPermanent, Err: fmt.Errorf("failed to parse: %v", err)}
 	}
 	return nil
 }
@@ -220,12 +331,12 @@ func (bucket blobStorageBucket) listAll(ctx context.Context, prefix string) ([]s
 }
 
 // Gets all build ids for a job.
-func (bucket blobStorageBucket) listBuildIDs(ctx context.Context, root string) ([]int64, error) {
+func listBuildIDs(ctx context.Context, bucket storageBucket, root string) ([]int64, error) {
 	ids := []int64{}
-	if strings.HasPrefix(root, logsPrefix) {
+	if bucket.getLayout().storesBuilds(root) {
 		dirs, err := bucket.listSubDirs(ctx, root)
 		if err != nil {
-			return ids, fmt.Errorf("failed to list directories: %v", err)
+			return ids, fmt.Errorf("failed to list directories: %w", err)
 		}
 		for _, dir := range dirs {
 			leaf := path.Base(dir)
@@ -239,7 +350,7 @@ func (bucket blobStorageBucket) listBuildIDs(ctx context.Context, root string) (
 	} else {
 		keys, err := bucket.listAll(ctx, root)
 		if err != nil {
-			return ids, fmt.Errorf("failed to list keys: %v", err)
+			return ids, fmt.Errorf("failed to list keys: %w", err)
 		}
 		for _, key := range keys {
 			matches := linkRe.FindStringSubmatch(key)
@@ -256,7 +367,7 @@ func (bucket blobStorageBucket) listBuildIDs(ctx context.Context, root string) (
 	return ids, nil
 }
 
-// parseJobHistURL parses the job History URL
+// ParseJobHistURL parses the job History URL
 // example urls:
 // * new format: https://prow.k8s.io/job-history/gs/kubernetes-jenkins/pr-logs/directory/pull-capi?buildId=1245584383100850177
 // * old format: https://prow.k8s.io/job-history/kubernetes-jenkins/pr-logs/directory/pull-capi?buildId=1245584383100850177
@@ -267,7 +378,7 @@ func (bucket blobStorageBucket) listBuildIDs(ctx context.Context, root string) (
 // * bucketName: kubernetes-jenkins
 // * root: pr-logs/directory/pull-capi
 // * buildID: 1245584383100850177
-func parseJobHistURL(url *url.URL) (storageProvider, bucketName, root string, buildID int64, err error) {
+func ParseJobHistURL(url *url.URL) (storageProvider, bucketName, root string, buildID int64, err error) {
 	buildID = emptyID
 	p := strings.TrimPrefix(url.Path, "/job-history/")
 	// examples for p:
@@ -313,41 +424,37 @@ func parseJobHistURL(url *url.URL) (storageProvider, bucketName, root string, bu
 	return
 }
 
-func linkID(url *url.URL, id int64) string {
-	u := *url
-	q := u.Query()
-	var val string
-	if id != emptyID {
-		val = strconv.FormatInt(id, 10)
-	}
-	q.Set(idParam, val)
-	u.RawQuery = q.Encode()
-	return u.String()
-}
-
 func getBuildData(ctx context.Context, bucket storageBucket, dir string) (BuildData, error) {
 	b := BuildData{
-		Result:     "Unknown",
-		commitHash: "Unknown",
+		Result: "Unknown",
 	}
 	started := gcs.Started{}
 	err := readJSON(ctx, bucket, path.Join(dir, "started.json"), &started)
 	if err != nil {
-		return b, fmt.Errorf("failed to read started.json: %v", err)
+		return b, err
 	}
 	b.Started = time.Unix(started.Timestamp, 0)
 	if commitHash, err := getPullCommitHash(started.Pull); err == nil {
-		b.commitHash = commitHash
+		b.CommitHash = commitHash
 	}
+	b.Repos = started.Repos
+	b.RepoCommit = started.RepoCommit
+	b.StartedMetadata = started.Metadata
 	finished := gcs.Finished{}
 	err = readJSON(ctx, bucket, path.Join(dir, "finished.json"), &finished)
 	if err != nil {
+		if Classify(err) != ErrorNotFound {
+			return b, err
+		}
 		b.Result = "Pending"
 		logrus.Debugf("failed to read finished.json (job might be unfinished): %v", err)
 	}
 	prowJob := v1.ProwJob{}
 	err = readJSON(ctx, bucket, path.Join(dir, "prowjob.json"), &prowJob)
 	if err != nil {
+		if Classify(err) != ErrorNotFound {
+			return b, err
+		}
 		logrus.Debugf("failed to read prowjob.json (job might be unfinished): %v", err)
 	} else {
 		b.ProwJob = prowJob
@@ -357,7 +464,7 @@ func getBuildData(ctx context.Context, bucket storageBucket, dir string) (BuildD
 	// the actual finished.json is still using revision and maps to DeprecatedRevision.
 	// TODO(ttyang): update both to match when fejta completely removes DeprecatedRevision.
 	if finished.DeprecatedRevision != "" {
-		b.commitHash = finished.DeprecatedRevision
+		b.CommitHash = finished.DeprecatedRevision
 	}
 
 	if finished.Timestamp != nil {
@@ -368,30 +475,10 @@ func getBuildData(ctx context.Context, bucket storageBucket, dir string) (BuildD
 	if finished.Result != "" {
 		b.Result = finished.Result
 	}
+	b.FinishedMetadata = finished.Metadata
 	return b, nil
 }
 
-// assumes a to be sorted in descending order
-// returns a subslice of a along with its indices (inclusive)
-func cropResults(a []int64, max int64) ([]int64, int, int) {
-	res := []int64{}
-	firstIndex := -1
-	lastIndex := 0
-	for i, v := range a {
-		if v <= max {
-			res = append(res, v)
-			if firstIndex == -1 {
-				firstIndex = i
-			}
-			lastIndex = i
-			if len(res) >= resultsPerPage {
-				break
-			}
-		}
-	}
-	return res, firstIndex, lastIndex
-}
-
 // golang <3
 type int64slice []int64
 
@@ -399,88 +486,144 @@ func (a int64slice) Len() int           { return len(a) }
 func (a int64slice) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a int64slice) Less(i, j int) bool { return a[i] < a[j] }
 
-// Gets job history from the bucket specified in config.
-func GetJobHistory(ctx context.Context, url *url.URL, opener pkgio.Opener) (jobHistoryTemplate, error) {
+// GetJobBuilds gets the builds of the job stored under root, newest first,
+// up to the first build that started before cutoff or whose ID is at or
+// below after. Builds newer than top are skipped unless top is negative. The
+// bucket is listed once and build metadata is fetched by at most concurrency
+// workers. Builds that can't be loaded are left out and reported in the
+// returned error alongside the builds that were loaded.
+func GetJobBuilds(ctx context.Context, bucket Bucket, root string, top int64, cutoff time.Time, after int64, concurrency int) ([]BuildData, error) {
 	start := time.Now()
-	tmpl := jobHistoryTemplate{}
 
-	storageProvider, bucketName, root, top, err := parseJobHistURL(url)
-	if err != nil {
-		return tmpl, fmt.Errorf("invalid url %s: %v", url.String(), err)
-	}
-	tmpl.Name = root
-	bucket := blobStorageBucket{bucketName, storageProvider, opener}
+	builds, err := getJobBuilds(ctx, bucket, root, top, cutoff, after, concurrency)
 
-	latest, err := readLatestBuild(ctx, bucket, root)
-	if err != nil {
-		return tmpl, fmt.Errorf("failed to locate build data: %v", err)
-	}
-	if top == emptyID || top > latest {
-		top = latest
-	}
-	if top != latest {
-		tmpl.LatestLink = linkID(url, emptyID)
-	}
+	logrus.Infof("loaded %d builds from %s in %v", len(builds), root, time.Since(start))
+	return builds, err
+}
+
+// GetBuildsByID gets the given builds of the job stored under root, newest
+// first. Builds that can't be loaded are reported as for GetJobBuilds.
+func GetBuildsByID(ctx context.Context, bucket Bucket, root string, ids []int64, concurrency int) ([]BuildData, error) {
+	buildIDs := append([]int64(nil), ids...)
+	sort.Sort(sort.Reverse(int64slice(buildIDs)))
+	return loadBuilds(ctx, bucket, root, buildIDs, time.Time{}, concurrency)
+}
 
-	buildIDs, err := bucket.listBuildIDs(ctx, root)
+func getJobBuilds(ctx context.Context, bucket storageBucket, root string, top int64, cutoff time.Time, after int64, concurrency int) ([]BuildData, error) {
+	buildIDs, err := listBuildIDs(ctx, bucket, root)
 	if err != nil {
-		return tmpl, fmt.Errorf("failed to get build ids: %v", err)
+		return nil, fmt.Errorf("failed to get build ids: %v", err)
 	}
 	sort.Sort(sort.Reverse(int64slice(buildIDs)))
+	if top >= 0 {
+		i := sort.Search(len(buildIDs), func(i int) bool { return buildIDs[i] <= top })
+		buildIDs = buildIDs[i:]
+	}
+	i := sort.Search(len(buildIDs), func(i int) bool { return buildIDs[i] <= after })
+	buildIDs = buildIDs[:i]
 
-	// determine which results to display on this page
-	shownIDs, firstIndex, lastIndex := cropResults(buildIDs, top)
+	return loadBuilds(ctx, bucket, root, buildIDs, cutoff, concurrency)
+}
 
-	// get links to the neighboring pages
-	if firstIndex > 0 {
-		nextIndex := firstIndex - resultsPerPage
-		// here emptyID indicates the most recent build, which will not necessarily be buildIDs[0]
-		next := emptyID
-		if nextIndex >= 0 {
-			next = buildIDs[nextIndex]
-		}
-		tmpl.NewerLink = linkID(url, next)
-	}
-	if lastIndex < len(buildIDs)-1 {
-		tmpl.OlderLink = linkID(url, buildIDs[lastIndex+1])
+// BuildError is a failure to load a build.
+type BuildError struct {
+	// Job is filled in by callers that know which job root belongs to.
+	Job     string
+	Root    string
+	BuildID int64
+	Err     error
+}
+
+func (e *BuildError) Error() string {
+	if e.Job != "" {
+		return fmt.Sprintf("job %s build %d: %v", e.Job, e.BuildID, e.Err)
 	}
+	return fmt.Sprintf("build %d under %s: %v", e.BuildID, e.Root, e.Err)
+}
 
-	tmpl.Builds = make([]BuildData, len(shownIDs))
-	tmpl.ResultsShown = len(shownIDs)
-	tmpl.ResultsTotal = len(buildIDs)
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
 
-	// concurrently fetch data for all of the builds to be shown
-	bch := make(chan BuildData)
-	for i, buildID := range shownIDs {
-		go func(i int, buildID int64) {
-			id := strconv.FormatInt(buildID, 10)
-			dir, err := bucket.getPath(ctx, root, id, "")
-			if err != nil {
-				if !pkgio.IsNotExist(err) {
-					logrus.WithError(err).Error("Failed to get path")
+// loadBuilds loads buildIDs, which must be sorted newest first, up to the
+// first build that started before cutoff. Builds that fail to load are left
+// out and reported as *BuildErrors in the returned aggregate.
+func loadBuilds(ctx context.Context, bucket storageBucket, root string, buildIDs []int64, cutoff time.Time, concurrency int) ([]BuildData, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// IDs are handed out newest first, so once a build older than the cutoff
+	// turns up every newer build has already been picked up by a worker and
+	// no more need to be started.
+	builds := make([]BuildData, len(buildIDs))
+	errs := make([]error, len(buildIDs))
+	var stop int32
+	ids := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range ids {
+				b, err := loadBuild(ctx, bucket, root, buildIDs[i])
+				if err != nil {
+					errs[i] = &BuildError{Root: root, BuildID: buildIDs[i], Err: err}
+					continue
+				}
+				b.index = i
+				builds[i] = b
+				if b.Started.Before(cutoff) {
+					atomic.StoreInt32(&stop, 1)
 				}
-				bch <- BuildData{}
-				return
-			}
-			b, err := getBuildData(ctx, bucket, dir)
-			if err != nil {
-				logrus.Warningf("build %d information incomplete: %v", buildID, err)
-			}
-			b.index = i
-			b.ID = id
-			b.SpyglassLink, err = bucket.spyglassLink(ctx, root, id)
-			if err != nil {
-				logrus.Errorf("failed to get spyglass link: %v", err)
 			}
-			bch <- b
-		}(i, buildID)
+		}()
 	}
-	for i := 0; i < len(shownIDs); i++ {
-		b := <-bch
-		tmpl.Builds[b.index] = b
+	for i := range buildIDs {
+		if atomic.LoadInt32(&stop) == 1 || ctx.Err() != nil {
+			break
+		}
+		ids <- i
 	}
+	close(ids)
+	wg.Wait()
 
-	elapsed := time.Now().Sub(start)
-	logrus.Infof("loaded %s in %v", url.Path, elapsed)
-	return tmpl, nil
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var shown []BuildData
+	var failed []error
+	for i, b := range builds {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+			continue
+		}
+		if b.ID == "" {
+			// never handed out
+			continue
+		}
+		if b.Started.Before(cutoff) {
+			break
+		}
+		shown = append(shown, b)
+	}
+	return shown, utilerrors.NewAggregate(failed)
+}
+
+// loadBuild reads the metadata for a single build.
+func loadBuild(ctx context.Context, bucket storageBucket, root string, buildID int64) (BuildData, error) {
+	id := strconv.FormatInt(buildID, 10)
+	dir, err := getPath(ctx, bucket, root, id, "")
+	if err != nil {
+		return BuildData{}, err
+	}
+	b, err := getBuildData(ctx, bucket, dir)
+	if err != nil {
+		return BuildData{}, err
+	}
+	b.ID = id
+	b.Prefix = dir
+	b.SpyglassLink = spyglassLink(bucket, dir)
+	return b, nil
 }
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFakeJob writes builds 1 to n of job to a fake bucket, one a minute up to
+// now, and returns the bucket and the job's root.
+func newFakeJob(job string, n int, now time.Time) (*fakeBucket, string) {
+	bucket := newFakeBucket()
+	root := "logs/" + job
+	for id := 1; id <= n; id++ {
+		dir := fmt.Sprintf("%s/%d", root, id)
+		started := now.Add(time.Duration(id-n) * time.Minute).Unix()
+		bucket.write(dir+"/started.json", fmt.Sprintf(`{"timestamp":%d}`, started))
+		bucket.write(dir+"/finished.json", fmt.Sprintf(`{"timestamp":%d,"result":"SUCCESS"}`, started+30))
+		bucket.write(dir+"/prowjob.json", `{"spec":{"job":"`+job+`"}}`)
+	}
+	bucket.write(root+"/"+latestBuildFile, fmt.Sprint(n))
+	return bucket, root
+}
+
+// getJobBuildsPaged gets builds the way job history pages did before
+// getJobBuilds: every page of resultsPerPage builds lists the whole job again
+// and loads its builds with a goroutine each.
+func getJobBuildsPaged(ctx context.Context, bucket storageBucket, root string, cutoff time.Time) ([]BuildData, error) {
+	const resultsPerPage = 20
+	var builds []BuildData
+	top := int64(-1)
+	for {
+		buildIDs, err := listBuildIDs(ctx, bucket, root)
+		if err != nil {
+			return nil, err
+		}
+		sort.Sort(sort.Reverse(int64slice(buildIDs)))
+		if top >= 0 {
+			i := sort.Search(len(buildIDs), func(i int) bool { return buildIDs[i] <= top })
+			buildIDs = buildIDs[i:]
+		}
+		if len(buildIDs) > resultsPerPage {
+			buildIDs = buildIDs[:resultsPerPage]
+		}
+
+		page := make([]BuildData, len(buildIDs))
+		errs := make([]error, len(buildIDs))
+		var wg sync.WaitGroup
+		for i, id := range buildIDs {
+			wg.Add(1)
+			go func(i int, id int64) {
+				defer wg.Done()
+				page[i], errs[i] = loadBuild(ctx, bucket, root, id)
+			}(i, id)
+		}
+		wg.Wait()
+		for i, b := range page {
+			if errs[i] != nil {
+				return nil, errs[i]
+			}
+			if b.Started.Before(cutoff) {
+				return builds, nil
+			}
+			builds = append(builds, b)
+		}
+		if len(buildIDs) < resultsPerPage {
+			return builds, nil
+		}
+		top = buildIDs[len(buildIDs)-1] - 1
+	}
+}
+
+func BenchmarkGetJobBuilds(b *testing.B) {
+	const (
+		total  = 5000
+		window = 1000
+	)
+	ctx := context.Background()
+	now := time.Now()
+	bucket, root := newFakeJob("periodic-bench", total, now)
+	// Builds start a minute apart, so the window holds the newest builds.
+	cutoff := now.Add(-(window - 1) * time.Minute).Add(-time.Second)
+
+	for _, bench := range []struct {
+		name string
+		get  func() ([]BuildData, error)
+	}{
+		{
+			name: "single listing",
+			get: func() ([]BuildData, error) {
+				return getJobBuilds(ctx, bucket, root, -1, cutoff, 0, 20)
+			},
+		},
+		{
+			name: "paged listing",
+			get: func() ([]BuildData, error) {
+				return getJobBuildsPaged(ctx, bucket, root, cutoff)
+			},
+		},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			lists := bucket.listCount()
+			for i := 0; i < b.N; i++ {
+				builds, err := bench.get()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(builds) != window {
+					b.Fatalf("got %d builds, want %d", len(builds), window)
+				}
+			}
+			b.ReportMetric(float64(bucket.listCount()-lists)/float64(b.N), "lists/op")
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileStorageProvider names buckets mirrored to a local directory.
+const FileStorageProvider = "file"
+
+// localStorageBucket is a storageBucket backed by a directory laid out like a
+// bucket, with one file per object. It lets job history be read from a
+// mirrored copy of a bucket without network access.
+type localStorageBucket struct {
+	dir    string
+	layout Layout
+}
+
+func (bucket localStorageBucket) getName() string {
+	return bucket.dir
+}
+
+func (bucket localStorageBucket) getStorageProvider() string {
+	return FileStorageProvider
+}
+
+func (bucket localStorageBucket) getLayout() Layout {
+	return bucket.layout
+}
+
+func (bucket localStorageBucket) path(key string) string {
+	return filepath.Join(bucket.dir, filepath.FromSlash(key))
+}
+
+func (bucket localStorageBucket) readObject(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(bucket.path(key))
+}
+
+func (bucket localStorageBucket) readRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(bucket.path(key))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (bucket localStorageBucket) attributes(ctx context.Context, key string) (ObjectAttributes, error) {
+	info, err := os.Stat(bucket.path(key))
+	if err != nil {
+		return ObjectAttributes{}, err
+	}
+	// A rewritten file has a new modification time.
+	generation := strconv.FormatInt(info.ModTime().UnixNano(), 10)
+	return ObjectAttributes{Size: info.Size(), Generation: generation}, nil
+}
+
+// Lists the "directory paths" immediately under prefix, in the same form as
+// blobStorageBucket.
+func (bucket localStorageBucket) listSubDirs(ctx context.Context, prefix string) ([]string, error) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	entries, err := os.ReadDir(bucket.path(prefix))
+	if err != nil {
+		// A bucket lists nothing under a prefix without objects.
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	dirs := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, prefix+entry.Name()+"/")
+		}
+	}
+	return dirs, nil
+}
+
+// Lists all keys with given prefix. Like a bucket listing, the prefix needn't
+// end at a directory boundary.
+func (bucket localStorageBucket) listAll(ctx context.Context, prefix string) ([]string, error) {
+	dir := prefix
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	keys := []string{}
+	err := filepath.WalkDir(bucket.path(dir), func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(bucket.dir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gocloud.dev/gcerrors"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/wait"
+	pkgio "k8s.io/test-infra/prow/io"
+)
+
+// ErrorClass sorts bucket read failures by how they should be handled.
+type ErrorClass string
+
+const (
+	// ErrorNotFound means the object doesn't exist. For optional objects
+	// such as finished.json this is expected.
+	ErrorNotFound ErrorClass = "not-found"
+	// ErrorPermissionDenied means the credentials in use can't read the
+	// object. Retrying won't help.
+	ErrorPermissionDenied ErrorClass = "permission-denied"
+	// ErrorTransient means the read may succeed if retried, e.g. after a
+	// 429 or 503 response or a dropped connection.
+	ErrorTransient ErrorClass = "transient"
+	// ErrorPermanent covers everything else, such as unparseable objects.
+	ErrorPermanent ErrorClass = "permanent"
+)
+
+// Classify returns the class of an error returned by a bucket read.
+func Classify(err error) ErrorClass {
+	var objectErr *ObjectError
+	if errors.As(err, &objectErr) {
+		return objectErr.Class
+	}
+	if pkgio.IsNotExist(err) {
+		return ErrorNotFound
+	}
+	if os.IsPermission(err) {
+		return ErrorPermissionDenied
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusNotFound:
+			return ErrorNotFound
+		case apiErr.Code == http.StatusUnauthorized, apiErr.Code == http.StatusForbidden:
+			return ErrorPermissionDenied
+		case apiErr.Code == http.StatusTooManyRequests, apiErr.Code >= 500:
+			return ErrorTransient
+		}
+		return ErrorPermanent
+	}
+	switch gcerrors.Code(err) {
+	case gcerrors.PermissionDenied:
+		return ErrorPermissionDenied
+	case gcerrors.ResourceExhausted, gcerrors.Internal, gcerrors.DeadlineExceeded:
+		return ErrorTransient
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTransient
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorTransient
+	}
+	return ErrorPermanent
+}
+
+// ObjectError is a failure to read or list a bucket key, after any retries.
+type ObjectError struct {
+	Key   string
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ObjectError) Error() string {
+	return fmt.Sprintf("%s (%s): %v", e.Key, e.Class, e.Err)
+}
+
+func (e *ObjectError) Unwrap() error {
+	return e.Err
+}
+
+// RetryOptions control how bucket reads are throttled and retried.
+type RetryOptions struct {
+	// Retries is how many times a read failing with a transient error is
+	// retried before giving up.
+	Retries int
+	// Backoff is the delay before the first retry. It doubles with each
+	// further retry and is jittered so parallel readers don't retry in step.
+	Backoff time.Duration
+	// QPS limits the rate of reads across the whole bucket. Zero means no
+	// limit.
+	QPS float64
+}
+
+// retryingBucket wraps a storageBucket to throttle reads and retry those
+// that fail with transient errors. Errors it returns are *ObjectErrors.
+type retryingBucket struct {
+	storageBucket
+	limiter *rate.Limiter
+	backoff wait.Backoff
+}
+
+func newRetryingBucket(bucket storageBucket, opts RetryOptions) retryingBucket {
+	limit, burst := rate.Inf, 0
+	if opts.QPS > 0 {
+		limit, burst = rate.Limit(opts.QPS), int(opts.QPS)+1
+	}
+	return retryingBucket{
+		storageBucket: bucket,
+		limiter:       rate.NewLimiter(limit, burst),
+		backoff: wait.Backoff{
+			Duration: opts.Backoff,
+			Factor:   2,
+			Jitter:   0.5,
+			Steps:    opts.Retries,
+		},
+	}
+}
+
+func (bucket retryingBucket) do(ctx context.Context, key string, read func() error) error {
+	backoff := bucket.backoff
+	for {
+		if err := bucket.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		err := read()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		class := Classify(err)
+		if class != ErrorTransient || backoff.Steps < 1 {
+			return &ObjectError{Key: key, Class: class, Err: err}
+		}
+		delay := backoff.Step()
+		logrus.WithError(err).Debugf("retrying %s in %v", key, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (bucket retryingBucket) readObject(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := bucket.do(ctx, key, func() (err error) {
+		data, err = bucket.storageBucket.readObject(ctx, key)
+		return err
+	})
+	return data, err
+}
+
+func (bucket retryingBucket) listSubDirs(ctx context.Context, prefix string) ([]string, error) {
+	var dirs []string
+	err := bucket.do(ctx, prefix, func() (err error) {
+		dirs, err = bucket.storageBucket.listSubDirs(ctx, prefix)
+		return err
+	})
+	return dirs, err
+}
+
+func (bucket retryingBucket) listAll(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := bucket.do(ctx, prefix, func() (err error) {
+		keys, err = bucket.storageBucket.listAll(ctx, prefix)
+		return err
+	})
+	return keys, err
+}
+
+func (bucket retryingBucket) attributes(ctx context.Context, key string) (ObjectAttributes, error) {
+	var attrs ObjectAttributes
+	err := bucket.do(ctx, key, func() (err error) {
+		attrs, err = bucket.storageBucket.attributes(ctx, key)
+		return err
+	})
+	return attrs, err
+}
+
+// readRange opens the object with retries. The reader it returns also reopens
+// the object where it left off if reading fails with a transient error, up to
+// the configured number of retries.
+func (bucket retryingBucket) readRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	r := &resumingReader{bucket: bucket, ctx: ctx, key: key, offset: offset, length: length, resumes: bucket.backoff.Steps}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type resumingReader struct {
+	bucket  retryingBucket
+	ctx     context.Context
+	key     string
+	offset  int64
+	length  int64
+	resumes int
+	rc      io.ReadCloser
+}
+
+func (r *resumingReader) open() error {
+	return r.bucket.do(r.ctx, r.key, func() (err error) {
+		r.rc, err = r.bucket.storageBucket.readRange(r.ctx, r.key, r.offset, r.length)
+		return err
+	})
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.offset += int64(n)
+	if r.length >= 0 {
+		r.length -= int64(n)
+	}
+	if err == nil || err == io.EOF || r.ctx.Err() != nil || Classify(err) != ErrorTransient || r.resumes < 1 {
+		return n, err
+	}
+	logrus.WithError(err).Debugf("resuming %s at offset %d", r.key, r.offset)
+	r.resumes--
+	r.rc.Close()
+	if err := r.open(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (r *resumingReader) Close() error {
+	if r.rc == nil {
+		// reopening failed
+		return nil
+	}
+	return r.rc.Close()
+}
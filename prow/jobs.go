@@ -0,0 +1,355 @@
+package prow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ironcladlou/prowdb/prow/internal"
+	"github.com/spf13/pflag"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	v1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	prowio "k8s.io/test-infra/prow/io"
+)
+
+// JobTypeFromName infers a job's type from the naming conventions used by
+// OpenShift CI. It returns false for names that don't follow them.
+func JobTypeFromName(job string) (v1.ProwJobType, bool) {
+	switch {
+	case strings.HasPrefix(job, "pull-"), strings.HasPrefix(job, "rehearse-"):
+		return v1.PresubmitJob, true
+	case strings.HasPrefix(job, "branch-"), strings.HasPrefix(job, "post-"):
+		return v1.PostsubmitJob, true
+	case strings.HasPrefix(job, "periodic-"):
+		return v1.PeriodicJob, true
+	}
+	return "", false
+}
+
+// historyPrefix returns the bucket prefix under which jobs of type t are
+// stored. Presubmit and batch builds are indexed by symlinks under the PR
+// logs prefix, postsubmits and periodics are stored directly under the logs
+// prefix.
+func historyPrefix(storage StorageOptions, t v1.ProwJobType) (string, error) {
+	switch t {
+	case v1.PresubmitJob, v1.BatchJob:
+		return storage.PRLogsPrefix, nil
+	case v1.PostsubmitJob, v1.PeriodicJob:
+		return storage.LogsPrefix, nil
+	}
+	return "", fmt.Errorf("unsupported job type %q (expected one of %s, %s, %s, %s)", t, v1.PresubmitJob, v1.PostsubmitJob, v1.PeriodicJob, v1.BatchJob)
+}
+
+// Validate reports --job-type values that aren't a ProwJobType.
+func (o SourceOptions) Validate() error {
+	for job, t := range o.JobTypes {
+		if _, err := historyPrefix(o.Storage, v1.ProwJobType(t)); err != nil {
+			return fmt.Errorf("invalid --job-type %s=%s: %w", job, t, err)
+		}
+	}
+	return nil
+}
+
+// resolveJobRoot finds the bucket prefix holding a job's history. The type
+// given in opts.JobTypes wins, then the type implied by the job's name. When
+// neither applies and opts.Probe is set, both prefixes are checked for the job.
+func resolveJobRoot(ctx context.Context, bucket internal.Bucket, opts SourceOptions, job string) (string, error) {
+	t, ok := v1.ProwJobType(opts.JobTypes[job]), opts.JobTypes[job] != ""
+	if !ok {
+		t, ok = JobTypeFromName(job)
+	}
+	if ok {
+		prefix, err := historyPrefix(opts.Storage, t)
+		if err != nil {
+			return "", fmt.Errorf("job %s: %w", job, err)
+		}
+		return path.Join(prefix, job), nil
+	}
+
+	if !opts.Probe {
+		return "", fmt.Errorf("cannot determine the type of job %s from its name; set it with --job-type %s=<type> or enable --probe", job, job)
+	}
+	return probeJobRoot(ctx, bucket, opts.Storage, job)
+}
+
+// probeJobRoot looks for a job's latest-build.txt under each prefix. If the
+// job has history under both, the one with the newer build is used.
+func probeJobRoot(ctx context.Context, bucket internal.Bucket, storage StorageOptions, job string) (string, error) {
+	var root string
+	latest := int64(-1)
+	for _, prefix := range []string{storage.LogsPrefix, storage.PRLogsPrefix} {
+		candidate := path.Join(prefix, job)
+		id, err := internal.LatestBuild(ctx, bucket, candidate)
+		if err != nil {
+			if !prowio.IsNotExist(err) {
+				return "", fmt.Errorf("probing %s: %w", candidate, err)
+			}
+			continue
+		}
+		if id > latest {
+			root, latest = candidate, id
+		}
+	}
+	if root == "" {
+		return "", fmt.Errorf("job %s not found under %s/ or %s/", job, storage.LogsPrefix, storage.PRLogsPrefix)
+	}
+	log.Printf("found job %s under %s", job, root)
+	return root, nil
+}
+
+// DefaultJob is selected when no jobs are selected explicitly.
+const DefaultJob = "pull-ci-openshift-hypershift-main-e2e-aws"
+
+// JobSelector picks jobs by name or by matching the jobs found in the bucket.
+type JobSelector struct {
+	Jobs []string
+	// Regex, Org, Repo and AllPeriodics select discovered jobs. A job must
+	// match all of those given.
+	Regex        string
+	Org          string
+	Repo         string
+	AllPeriodics bool
+}
+
+// AddFlags binds the selector to flags.
+func (s *JobSelector) AddFlags(flags *pflag.FlagSet) {
+	flags.StringArrayVarP(&s.Jobs, "job", "", nil, fmt.Sprintf("jobs to find (default %s when no other selector is given)", DefaultJob))
+	flags.StringVarP(&s.Regex, "job-regex", "", "", "find jobs with names matching this regular expression")
+	flags.StringVarP(&s.Org, "org", "", "", "find ci-operator jobs testing this GitHub org")
+	flags.StringVarP(&s.Repo, "repo", "", "", "find ci-operator jobs testing this GitHub repo (requires --org)")
+	flags.BoolVarP(&s.AllPeriodics, "all-periodics", "", false, "find all periodic jobs")
+}
+
+func (s JobSelector) discovers() bool {
+	return s.Regex != "" || s.Org != "" || s.Repo != "" || s.AllPeriodics
+}
+
+// Validate reports selectors that can't be used together or don't parse.
+func (s JobSelector) Validate() error {
+	_, err := s.matcher()
+	return err
+}
+
+// matcher returns a predicate implementing the discovery selectors.
+func (s JobSelector) matcher() (func(job string) bool, error) {
+	if s.Repo != "" && s.Org == "" {
+		return nil, fmt.Errorf("--repo requires --org")
+	}
+	var re *regexp.Regexp
+	if s.Regex != "" {
+		var err error
+		re, err = regexp.Compile(s.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job regex: %w", err)
+		}
+	}
+	// ci-operator job names start with the org and repo they test, as in
+	// pull-ci-<org>-<repo>-<branch>-<test>. Orgs and repos may contain
+	// dashes, so a name can't tell openshift from openshift-priv; SelectJobs
+	// checks the refs of the jobs it finds this way.
+	var orgRepo *regexp.Regexp
+	if s.Org != "" {
+		pattern := "^(pull|branch|periodic|rehearse)-ci-" + regexp.QuoteMeta(s.Org) + "-"
+		if s.Repo != "" {
+			pattern += regexp.QuoteMeta(s.Repo) + "-"
+		}
+		orgRepo = regexp.MustCompile(pattern)
+	}
+	return func(job string) bool {
+		if re != nil && !re.MatchString(job) {
+			return false
+		}
+		if orgRepo != nil && !orgRepo.MatchString(job) {
+			return false
+		}
+		if s.AllPeriodics && !strings.HasPrefix(job, "periodic-") {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// testsRefs reports whether a ProwJob tests the org and repo selected by
+// --org and --repo. The repo tested is the one in its refs, or for
+// periodics the first of its extra refs. A ProwJob without refs can't be
+// told apart, so it's kept.
+func (s JobSelector) testsRefs(prowJob v1.ProwJob) bool {
+	refs := prowJob.Spec.Refs
+	if refs == nil && len(prowJob.Spec.ExtraRefs) > 0 {
+		refs = &prowJob.Spec.ExtraRefs[0]
+	}
+	if refs == nil {
+		return true
+	}
+	return refs.Org == s.Org && (s.Repo == "" || refs.Repo == s.Repo)
+}
+
+// jobPrefix is a bucket prefix holding job history, along with the type
+// assumed for jobs found there.
+type jobPrefix struct {
+	prefix  string
+	jobType v1.ProwJobType
+}
+
+// SelectJobs returns the jobs named by sel in the order given, followed by
+// the other jobs it discovers in sorted order. Discovered jobs whose type
+// can't be inferred from their name are added to opts.JobTypes according to
+// the prefix they were found under.
+func SelectJobs(ctx context.Context, opts *SourceOptions, sel JobSelector) ([]string, error) {
+	if !sel.discovers() {
+		return FilterJobs(nil, sel)
+	}
+	if err := sel.Validate(); err != nil {
+		return nil, err
+	}
+	bucket, err := openBucket(ctx, opts.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Periodics are only ever stored under the logs prefix.
+	prefixes := []jobPrefix{{opts.Storage.LogsPrefix, v1.PeriodicJob}}
+	if !sel.AllPeriodics {
+		prefixes = append(prefixes, jobPrefix{opts.Storage.PRLogsPrefix, v1.PresubmitJob})
+	}
+	var known []string
+	found := map[string]jobPrefix{}
+	for _, p := range prefixes {
+		jobs, err := internal.ListJobs(ctx, bucket, p.prefix)
+		if err != nil {
+			return nil, fmt.Errorf("listing jobs under %s: %w", p.prefix, err)
+		}
+		for _, job := range jobs {
+			if _, ok := found[job]; !ok {
+				found[job] = p
+				known = append(known, job)
+			}
+		}
+	}
+
+	jobs, err := FilterJobs(known, sel)
+	if err != nil {
+		return nil, err
+	}
+	named := sets.NewString(sel.Jobs...)
+	if sel.Org != "" {
+		jobs, err = filterRefs(ctx, bucket, sel, jobs, named, found)
+		if err != nil {
+			return nil, err
+		}
+	}
+	discovered := 0
+	for _, job := range jobs {
+		if named.Has(job) {
+			continue
+		}
+		discovered++
+		if _, ok := JobTypeFromName(job); !ok && opts.JobTypes[job] == "" {
+			if opts.JobTypes == nil {
+				opts.JobTypes = map[string]string{}
+			}
+			opts.JobTypes[job] = string(found[job].jobType)
+		}
+	}
+	log.Printf("discovered %d jobs", discovered)
+	return jobs, nil
+}
+
+// refsConcurrency is the number of discovered jobs whose refs are read in
+// parallel.
+const refsConcurrency = 20
+
+// filterRefs drops the discovered jobs whose latest build tests another org
+// or repo than sel selects. Jobs without a ProwJob to check are kept.
+func filterRefs(ctx context.Context, bucket internal.Bucket, sel JobSelector, jobs []string, named sets.String, found map[string]jobPrefix) ([]string, error) {
+	keep := make([]bool, len(jobs))
+	errs := make([]error, len(jobs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < refsConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				keep[i], errs[i] = latestTestsRefs(ctx, bucket, sel, path.Join(found[jobs[i]].prefix, jobs[i]))
+			}
+		}()
+	}
+	for i, job := range jobs {
+		if named.Has(job) {
+			keep[i] = true
+			continue
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	if err := utilerrors.NewAggregate(errs); err != nil {
+		return nil, err
+	}
+
+	var kept []string
+	for i, job := range jobs {
+		if keep[i] {
+			kept = append(kept, job)
+		}
+	}
+	return kept, nil
+}
+
+// latestTestsRefs reports whether the latest build of the job at root tests
+// the org and repo sel selects.
+func latestTestsRefs(ctx context.Context, bucket internal.Bucket, sel JobSelector, root string) (bool, error) {
+	id, err := internal.LatestBuild(ctx, bucket, root)
+	if err != nil {
+		if Classify(err) == ErrorNotFound {
+			return true, nil
+		}
+		return false, fmt.Errorf("reading the latest build of %s: %w", root, err)
+	}
+	prowJob, err := internal.ReadProwJob(ctx, bucket, root, id)
+	if err != nil {
+		if Classify(err) == ErrorNotFound {
+			return true, nil
+		}
+		return false, fmt.Errorf("reading the ProwJob of %s/%d: %w", root, id, err)
+	}
+	return sel.testsRefs(prowJob), nil
+}
+
+// FilterJobs returns the jobs named by sel in the order given, followed by
+// the jobs of known that it discovers in sorted order. It selects from jobs
+// already known, such as those stored in a database, instead of the bucket,
+// by name alone.
+func FilterJobs(known []string, sel JobSelector) ([]string, error) {
+	if len(sel.Jobs) == 0 && !sel.discovers() {
+		return []string{DefaultJob}, nil
+	}
+	var jobs []string
+	named := sets.NewString()
+	for _, job := range sel.Jobs {
+		if !named.Has(job) {
+			named.Insert(job)
+			jobs = append(jobs, job)
+		}
+	}
+	if !sel.discovers() {
+		return jobs, nil
+	}
+	match, err := sel.matcher()
+	if err != nil {
+		return nil, err
+	}
+	discovered := sets.NewString()
+	for _, job := range known {
+		if match(job) && !named.Has(job) {
+			discovered.Insert(job)
+		}
+	}
+	return append(jobs, discovered.List()...), nil
+}
@@ -0,0 +1,189 @@
+package prow
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJobSelectorMatcher(t *testing.T) {
+	tests := []struct {
+		name string
+		sel  JobSelector
+		job  string
+		want bool
+	}{
+		{
+			name: "org",
+			sel:  JobSelector{Org: "openshift"},
+			job:  "pull-ci-openshift-hypershift-main-e2e-aws",
+			want: true,
+		},
+		{
+			name: "org and repo",
+			sel:  JobSelector{Org: "openshift", Repo: "hypershift"},
+			job:  "periodic-ci-openshift-hypershift-main-periodics-e2e-aws",
+			want: true,
+		},
+		{
+			name: "other repo",
+			sel:  JobSelector{Org: "openshift", Repo: "hypershift"},
+			job:  "pull-ci-openshift-installer-master-e2e-aws",
+			want: false,
+		},
+		{
+			name: "org is not a prefix of a longer word",
+			sel:  JobSelector{Org: "open"},
+			job:  "pull-ci-openshift-hypershift-main-e2e-aws",
+			want: false,
+		},
+		{
+			name: "repo is not a prefix of a longer word",
+			sel:  JobSelector{Org: "openshift", Repo: "release"},
+			job:  "pull-ci-openshift-releases-master-unit",
+			want: false,
+		},
+		{
+			name: "org anywhere in the name",
+			sel:  JobSelector{Org: "4.10"},
+			job:  "periodic-ci-openshift-release-master-ci-4.10-e2e-aws",
+			want: false,
+		},
+		{
+			name: "repo anywhere in the name",
+			sel:  JobSelector{Org: "openshift", Repo: "installer"},
+			job:  "pull-ci-openshift-release-master-installer-e2e",
+			want: false,
+		},
+		// Orgs and repos may contain dashes, so these are only ruled out by
+		// the refs SelectJobs checks.
+		{
+			name: "org a dashed prefix of another",
+			sel:  JobSelector{Org: "openshift"},
+			job:  "periodic-ci-openshift-priv-hypershift-main-e2e-aws",
+			want: true,
+		},
+		{
+			name: "not a ci-operator job",
+			sel:  JobSelector{Org: "openshift"},
+			job:  "release-openshift-ocp-installer-e2e-aws-4.6",
+			want: false,
+		},
+		{
+			name: "all periodics",
+			sel:  JobSelector{Org: "openshift", AllPeriodics: true},
+			job:  "pull-ci-openshift-hypershift-main-e2e-aws",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := tt.sel.matcher()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := match(tt.job); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.job, got, tt.want)
+			}
+		})
+	}
+}
+
+// writeMirror writes a local mirror of a bucket holding periodics under
+// logs/ and, if prLogs is set, presubmits under pr-logs/.
+func writeMirror(t *testing.T, dir string, prLogs bool) {
+	write := func(key, data string) {
+		t.Helper()
+		p := filepath.Join(dir, filepath.FromSlash(key))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	periodic := func(job, org, repo string) {
+		write("logs/"+job+"/latest-build.txt", "1")
+		write("logs/"+job+"/1/prowjob.json", fmt.Sprintf(`{"spec":{"extra_refs":[{"org":%q,"repo":%q}]}}`, org, repo))
+	}
+	presubmit := func(job, org, repo string) {
+		build := fmt.Sprintf("pr-logs/pull/%s_%s/1/%s/5", org, repo, job)
+		write("pr-logs/directory/"+job+"/latest-build.txt", "5")
+		write("pr-logs/directory/"+job+"/5.txt", "gs://bucket/"+build)
+		write(build+"/prowjob.json", fmt.Sprintf(`{"spec":{"refs":{"org":%q,"repo":%q}}}`, org, repo))
+	}
+	periodic("periodic-ci-openshift-hypershift-main-e2e-aws", "openshift", "hypershift")
+	periodic("periodic-ci-openshift-priv-hypershift-main-e2e-aws", "openshift-priv", "hypershift")
+	// A job without a latest build can't be checked, so it's kept.
+	write("logs/periodic-ci-openshift-installer-master-e2e-aws/1/started.json", "{}")
+	if prLogs {
+		presubmit("pull-ci-openshift-release-master-unit", "openshift", "release")
+		presubmit("pull-ci-openshift-release-controller-master-unit", "openshift", "release-controller")
+	}
+}
+
+func TestSelectJobs(t *testing.T) {
+	tests := []struct {
+		name     string
+		noPRLogs bool
+		sel      JobSelector
+		want     []string
+	}{
+		{
+			name: "org",
+			sel:  JobSelector{Org: "openshift"},
+			want: []string{
+				"periodic-ci-openshift-hypershift-main-e2e-aws",
+				"periodic-ci-openshift-installer-master-e2e-aws",
+				"pull-ci-openshift-release-controller-master-unit",
+				"pull-ci-openshift-release-master-unit",
+			},
+		},
+		{
+			name: "org and repo",
+			sel:  JobSelector{Org: "openshift", Repo: "release"},
+			want: []string{"pull-ci-openshift-release-master-unit"},
+		},
+		{
+			name: "named jobs aren't checked",
+			sel:  JobSelector{Org: "openshift", Repo: "hypershift", Jobs: []string{"periodic-ci-openshift-priv-hypershift-main-e2e-aws"}},
+			want: []string{
+				"periodic-ci-openshift-priv-hypershift-main-e2e-aws",
+				"periodic-ci-openshift-hypershift-main-e2e-aws",
+			},
+		},
+		{
+			name:     "no pr-logs",
+			noPRLogs: true,
+			sel:      JobSelector{Regex: "-e2e-aws$"},
+			want: []string{
+				"periodic-ci-openshift-hypershift-main-e2e-aws",
+				"periodic-ci-openshift-installer-master-e2e-aws",
+				"periodic-ci-openshift-priv-hypershift-main-e2e-aws",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeMirror(t, dir, !tt.noPRLogs)
+			opts := &SourceOptions{Storage: StorageOptions{
+				Provider:     FileStorageProvider,
+				Bucket:       dir,
+				LogsPrefix:   DefaultLogsPrefix,
+				PRLogsPrefix: DefaultPRLogsPrefix,
+			}}
+			got, err := SelectJobs(context.Background(), opts, tt.sel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectJobs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package prow
+
+import (
+	"context"
+	"time"
+
+	"github.com/GoogleCloudPlatform/testgrid/metadata/junit"
+)
+
+// MaxTestMessage is the longest failure message kept for a test case.
+const MaxTestMessage = 4096
+
+// Test case statuses.
+const (
+	TestPassed  = "passed"
+	TestFailed  = "failed"
+	TestErrored = "errored"
+	TestSkipped = "skipped"
+)
+
+// TestCase is the result of a test case in a build's JUnit reports.
+type TestCase struct {
+	Suite    string
+	Name     string
+	Status   string
+	Duration time.Duration
+	// Message is the failure, error or skip message, truncated to
+	// MaxTestMessage bytes.
+	Message string
+}
+
+// GetTestCases reads the test cases from the junit*.xml reports the build
+// uploaded under artifacts/. A test run more than once, such as a retried
+// flake, appears once per run.
+func GetTestCases(ctx context.Context, artifacts *Artifacts, build Build) ([]TestCase, error) {
+	names, err := artifacts.Glob(ctx, build, "artifacts", "junit*.xml")
+	if err != nil {
+		return nil, err
+	}
+	var cases []TestCase
+	for _, name := range names {
+		data, err := artifacts.Read(ctx, build, name)
+		if err != nil {
+			return nil, err
+		}
+		suites, err := junit.Parse(data)
+		if err != nil {
+			return nil, buildError(build, &ObjectError{Key: build.Prefix + "/" + name, Class: ErrorPermanent, Err: err})
+		}
+		for _, suite := range suites.Suites {
+			cases = appendTestCases(cases, suite)
+		}
+	}
+	return cases, nil
+}
+
+func appendTestCases(cases []TestCase, suite junit.Suite) []TestCase {
+	for _, result := range suite.Results {
+		c := TestCase{
+			Suite:    suite.Name,
+			Name:     result.Name,
+			Status:   TestPassed,
+			Duration: time.Duration(result.Time * float64(time.Second)),
+		}
+		switch {
+		case result.Failure != nil:
+			c.Status = TestFailed
+		case result.Errored != nil:
+			c.Status = TestErrored
+		case result.Skipped != nil:
+			c.Status = TestSkipped
+		}
+		if c.Status != TestPassed {
+			c.Message = result.Message(MaxTestMessage)
+		}
+		cases = append(cases, c)
+	}
+	for _, nested := range suite.Suites {
+		cases = appendTestCases(cases, nested)
+	}
+	return cases
+}
@@ -2,95 +2,352 @@ package prow
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/url"
 	"path"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/ironcladlou/prowdb/prow/internal"
+	"github.com/spf13/pflag"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	prowio "k8s.io/test-infra/prow/io"
 )
 
 const (
-	DefaultBaseURL = "https://prow.ci.openshift.org"
+	DefaultBaseURL          = "https://prow.ci.openshift.org"
+	DefaultConcurrency      = 4
+	DefaultBuildConcurrency = 20
 )
 
+type (
+	// BuildError is a failure to load a build. It wraps the *ObjectError for
+	// the read that failed, if any.
+	BuildError = internal.BuildError
+	// ObjectError is a failure to read a bucket key after retries.
+	ObjectError = internal.ObjectError
+	// ErrorClass sorts bucket read failures.
+	ErrorClass = internal.ErrorClass
+	// Cache stores bucket objects on local disk by version.
+	Cache = internal.Cache
+	// CacheStats summarize the objects in a Cache.
+	CacheStats = internal.CacheStats
+)
+
+// NewCache returns a cache stored under dir.
+func NewCache(dir string) *Cache {
+	return internal.NewCache(dir)
+}
+
+const (
+	ErrorNotFound         = internal.ErrorNotFound
+	ErrorPermissionDenied = internal.ErrorPermissionDenied
+	ErrorTransient        = internal.ErrorTransient
+	ErrorPermanent        = internal.ErrorPermanent
+)
+
+// Classify returns the class of an error returned while reading a bucket.
+func Classify(err error) ErrorClass {
+	return internal.Classify(err)
+}
+
+// BuildVersion is the version of the Build record, as output by hist show. It
+// changes whenever a field is removed or changes meaning.
+const BuildVersion = 1
+
+// Build is a build of a job, with the metadata read from its started.json,
+// finished.json and prowjob.json.
 type Build struct {
+	Version int
+
 	internal.BuildData
 
 	Job string
 	URL string
 }
 
-func GetJobHistoryByJobName(ctx context.Context, baseURL string, from time.Duration, jobs ...string) ([]Build, error) {
+// SourceOptions describe the Prow deployment builds are read from.
+type SourceOptions struct {
+	// ConfigFile names a Config file providing defaults for the options.
+	ConfigFile string
+	BaseURL    string
+	Storage    StorageOptions
+	// JobTypes maps job names to their ProwJobType, for jobs whose type
+	// can't be inferred from their name.
+	JobTypes map[string]string
+	// Probe enables looking for jobs of unknown type under every prefix.
+	Probe bool
+}
+
+// AddFlags binds the options to flags shared by commands that read builds.
+func (o *SourceOptions) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.ConfigFile, "config", "", "", "YAML file describing the Prow deployment")
+	flags.StringVarP(&o.BaseURL, "base-url", "", DefaultBaseURL, "")
+	o.Storage.AddFlags(flags)
+	flags.StringToStringVarP(&o.JobTypes, "job-type", "", nil, "type of a job whose type can't be inferred from its name, as job=presubmit|postsubmit|periodic|batch")
+	flags.BoolVarP(&o.Probe, "probe", "", false, "look for jobs of unknown type under both logs/ and pr-logs/directory/")
+}
+
+// HistoryOptions control which builds are fetched and how hard the bucket is
+// hit while fetching them.
+type HistoryOptions struct {
+	SourceOptions
+	From time.Duration
+	// Concurrency is the number of jobs fetched in parallel.
+	Concurrency int
+	// BuildConcurrency is the number of builds fetched in parallel per job.
+	BuildConcurrency int
+	// Since maps job names to the newest build ID already known for the job.
+	// History for those jobs stops at that build instead of going back From.
+	Since map[string]int64
+}
+
+// AddFlags binds the options to flags shared by commands that fetch history.
+func (o *HistoryOptions) AddFlags(flags *pflag.FlagSet) {
+	o.SourceOptions.AddFlags(flags)
+	flags.DurationVarP(&o.From, "from", "", 24*time.Hour, "how far back to find builds")
+	flags.IntVarP(&o.Concurrency, "concurrency", "", DefaultConcurrency, "number of jobs to fetch in parallel")
+	flags.IntVarP(&o.BuildConcurrency, "build-concurrency", "", DefaultBuildConcurrency, "number of builds to fetch in parallel for each job")
+}
+
+// GetJobHistoryByJobName fetches the history of each job using at most
+// opts.Concurrency jobs at a time. Builds are returned in the order the jobs
+// were given, newest first within each job. A job that fails doesn't stop the
+// others; its error is included in the returned aggregate alongside whatever
+// builds were found for the remaining jobs.
+func GetJobHistoryByJobName(ctx context.Context, opts HistoryOptions, jobs ...string) ([]Build, error) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	bucket, err := openBucket(ctx, opts.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]Build, len(jobs))
+	errs := make([]error, len(jobs))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(jobs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i], errs[i] = getJobHistory(ctx, bucket, opts, jobs[i])
+			}
+		}()
+	}
+	for i := range jobs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
 	var builds []Build
-	for _, job := range jobs {
-		jobURL, err := url.Parse(baseURL)
-		if err != nil {
-			return nil, err
+	for _, jobBuilds := range results {
+		builds = append(builds, jobBuilds...)
+	}
+	return builds, utilerrors.NewAggregate(errs)
+}
+
+func getJobHistory(ctx context.Context, bucket internal.Bucket, opts HistoryOptions, job string) ([]Build, error) {
+	root, err := resolveJobRoot(ctx, bucket, opts.SourceOptions, job)
+	if err != nil {
+		return nil, attributeErrors(err, job)
+	}
+	cutoff := time.Now().Add(-opts.From).UTC()
+	after, ok := opts.Since[job]
+	if ok {
+		cutoff = time.Time{}
+	}
+	log.Printf("fetching job history for %s from %s", job, root)
+	fetchStarted := time.Now()
+	hist, err := internal.GetJobBuilds(ctx, bucket, root, -1, cutoff, after, opts.BuildConcurrency)
+	builds := newBuilds(opts.BaseURL, hist)
+	setJob(builds, job)
+	log.Printf("found %d prow builds for job %s in %v", len(builds), job, time.Since(fetchStarted)/time.Second)
+	return builds, attributeErrors(err, job)
+}
+
+// GetJobBuildsByID fetches specific builds of a job, newest first. Builds
+// that can't be found are left out.
+func GetJobBuildsByID(ctx context.Context, opts HistoryOptions, job string, ids ...int64) ([]Build, error) {
+	bucket, err := openBucket(ctx, opts.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := resolveJobRoot(ctx, bucket, opts.SourceOptions, job)
+	if err != nil {
+		return nil, attributeErrors(err, job)
+	}
+
+	hist, err := internal.GetBuildsByID(ctx, bucket, root, ids, opts.BuildConcurrency)
+	builds := newBuilds(opts.BaseURL, hist)
+	setJob(builds, job)
+	return builds, attributeErrors(err, job)
+}
+
+// JobError is a failure to read the history of a job as a whole, such as
+// when its builds can't be listed.
+type JobError struct {
+	Job string
+	Err error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("job %s: %v", e.Job, e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// attributeErrors fills in the job of the build errors in err. Any other
+// error is a failure of the job as a whole and becomes a *JobError.
+func attributeErrors(err error, job string) error {
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		errs = agg.Errors()
+	}
+	for i, err := range errs {
+		var buildErr *BuildError
+		if errors.As(err, &buildErr) {
+			buildErr.Job = job
+		} else {
+			errs[i] = &JobError{Job: job, Err: err}
 		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Failure describes a job or build that couldn't be read.
+type Failure struct {
+	Job string
+	// BuildID is zero for failures of the job as a whole.
+	BuildID int64
+	// Key is the bucket key whose read failed, if known.
+	Key   string
+	Class ErrorClass
+	Err   error
+}
 
-		var prefix string
+// Failures breaks an error returned while fetching history down into the jobs
+// and builds that failed. Errors not attributed to a job are left out.
+func Failures(err error) []Failure {
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		errs = utilerrors.Flatten(agg).Errors()
+	}
+	var failures []Failure
+	for _, err := range errs {
+		var failure Failure
+		var buildErr *BuildError
+		var jobErr *JobError
 		switch {
-		case strings.HasPrefix(job, "pull-"):
-			prefix = "job-history/gs/origin-ci-test/pr-logs/directory"
-		case strings.HasPrefix(job, "periodic-"):
-			prefix = "job-history/gs/origin-ci-test/logs"
+		case errors.As(err, &buildErr):
+			failure = Failure{Job: buildErr.Job, BuildID: buildErr.BuildID, Key: path.Join(buildErr.Root, fmt.Sprint(buildErr.BuildID)), Err: buildErr.Err}
+		case errors.As(err, &jobErr):
+			failure = Failure{Job: jobErr.Job, Err: jobErr.Err}
+		default:
+			continue
 		}
-		jobURL.Path = path.Join(jobURL.Path, prefix, job)
-		log.Println("fetching job history for", jobURL.String())
-		prowBuilds, err := GetJobHistoryByJobURL(ctx, baseURL, from, jobURL.String())
-		if err != nil {
-			return nil, err
+		var objectErr *ObjectError
+		if errors.As(failure.Err, &objectErr) {
+			failure.Key = objectErr.Key
 		}
-		log.Printf("found %d prow builds for job %s", len(prowBuilds), job)
-		builds = append(builds, prowBuilds...)
+		failure.Class = Classify(failure.Err)
+		failures = append(failures, failure)
 	}
-	return builds, nil
+	return failures
 }
 
-func GetJobHistoryByJobURL(ctx context.Context, baseURL string, from time.Duration, jobURL string) ([]Build, error) {
-	var builds []Build
+// openBucket opens the bucket described by storage. Local buckets are opened
+// without setting up cloud storage clients.
+func openBucket(ctx context.Context, storage StorageOptions) (internal.Bucket, error) {
+	var opener prowio.Opener
+	var attrs internal.AttributesReader
+	if storage.Provider != internal.FileStorageProvider {
+		var err error
+		opener, err = prowio.NewOpener(ctx, storage.GCSCredentialsFile, storage.S3CredentialsFile)
+		if err != nil {
+			return internal.Bucket{}, err
+		}
+		// Only the cache needs object generations, which the opener doesn't
+		// report.
+		if storage.CacheDir != "" {
+			attrs, err = internal.OpenAttributes(ctx, storage.Provider, storage.Bucket, storage.GCSCredentialsFile, storage.S3CredentialsFile)
+			if err != nil {
+				return internal.Bucket{}, err
+			}
+		}
+	}
+	layout := internal.Layout{LogsPrefix: storage.LogsPrefix}
+	retry := internal.RetryOptions{Retries: storage.Retries, Backoff: storage.RetryBackoff, QPS: storage.QPS}
+	var cache *Cache
+	if storage.CacheDir != "" {
+		cache = NewCache(storage.CacheDir)
+	}
+	return internal.NewBucket(opener, attrs, storage.Provider, storage.Bucket, layout, retry, cache), nil
+}
 
+// GetJobHistoryByJobURL fetches the history of the job at a deck job history
+// URL. The URL selects the storage provider and bucket, while credentials and
+// layout still come from opts.
+func GetJobHistoryByJobURL(ctx context.Context, opts HistoryOptions, jobURL string) ([]Build, error) {
 	u, err := url.Parse(jobURL)
 	if err != nil {
 		return nil, err
 	}
-
-	opener, err := prowio.NewOpener(ctx, "", "")
+	storageProvider, bucketName, root, top, err := internal.ParseJobHistURL(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s: %v", jobURL, err)
+	}
+	storage := opts.Storage
+	storage.Provider, storage.Bucket = storageProvider, bucketName
+	bucket, err := openBucket(ctx, storage)
 	if err != nil {
 		return nil, err
 	}
 
-	cutoff := time.Now().Add(-from).UTC()
-	nextURL := u
-	for done := false; !done; {
-		fetchStarted := time.Now()
-		hist, err := internal.GetJobHistory(ctx, nextURL, opener)
-		log.Printf("fetched job history from %s in %v", nextURL, time.Since(fetchStarted)/time.Second)
-		if err != nil {
-			return builds, err
-		}
-		for _, build := range hist.Builds {
-			if build.Started.Before(cutoff) {
-				done = true
-				break
-			}
-			buildURL, _ := url.Parse(baseURL)
-			buildURL.Path = path.Join(buildURL.Path, build.SpyglassLink)
-			builds = append(builds, Build{
-				BuildData: build,
-				Job:       build.ProwJob.Spec.Job,
-				URL:       buildURL.String(),
-			})
-		}
-		olderURL, err := url.Parse(hist.OlderLink)
-		if err != nil {
-			return nil, err
-		}
-		nextURL = olderURL
+	fetchStarted := time.Now()
+	hist, err := internal.GetJobBuilds(ctx, bucket, root, top, time.Now().Add(-opts.From).UTC(), 0, opts.BuildConcurrency)
+	log.Printf("fetched job history from %s in %v", u, time.Since(fetchStarted)/time.Second)
+
+	return newBuilds(opts.BaseURL, hist), err
+}
+
+func newBuilds(baseURL string, hist []internal.BuildData) []Build {
+	var builds []Build
+	for _, build := range hist {
+		buildURL, _ := url.Parse(baseURL)
+		buildURL.Path = path.Join(buildURL.Path, build.SpyglassLink)
+		builds = append(builds, Build{
+			Version:   BuildVersion,
+			BuildData: build,
+			Job:       build.ProwJob.Spec.Job,
+			URL:       buildURL.String(),
+		})
 	}
+	return builds
+}
 
-	return builds, nil
+// setJob fills in the job name of builds whose prowjob.json couldn't be read.
+func setJob(builds []Build, job string) {
+	for i := range builds {
+		if builds[i].Job == "" {
+			builds[i].Job = job
+		}
+	}
 }
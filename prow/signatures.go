@@ -0,0 +1,133 @@
+package prow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+
+	"sigs.k8s.io/yaml"
+)
+
+// BuildLog is the name of the log of a build's test container.
+const BuildLog = "build-log.txt"
+
+// MaxSignatureText is the longest matched line kept for a signature.
+const MaxSignatureText = 512
+
+// maxLogLine is the longest prefix of a log line matched against signatures.
+// The rest of longer lines is skipped.
+const maxLogLine = 64 * 1024
+
+// Signature is a named regular expression identifying a kind of failure in
+// build logs.
+type Signature struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// Signatures describes a signatures file, e.g.
+//
+//	signatures:
+//	- name: quota-exceeded
+//	  pattern: 'Quota .* exceeded'
+type Signatures struct {
+	Signatures []Signature `json:"signatures"`
+}
+
+// LoadSignatures reads and compiles the signatures in file.
+func LoadSignatures(file string) (*Signatures, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	sigs := &Signatures{}
+	if err := yaml.UnmarshalStrict(data, sigs); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	names := map[string]bool{}
+	for i := range sigs.Signatures {
+		sig := &sigs.Signatures[i]
+		if sig.Name == "" {
+			return nil, fmt.Errorf("%s: signature %d has no name", file, i)
+		}
+		if names[sig.Name] {
+			return nil, fmt.Errorf("%s: duplicate signature %s", file, sig.Name)
+		}
+		names[sig.Name] = true
+		sig.re, err = regexp.Compile(sig.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: signature %s: %w", file, sig.Name, err)
+		}
+	}
+	return sigs, nil
+}
+
+// SignatureMatch is the first line of a build log matching a signature.
+type SignatureMatch struct {
+	Name string
+	// Line is the 1-based number of the matching line.
+	Line int
+	// Text is the matching line, truncated to MaxSignatureText bytes.
+	Text string
+}
+
+// ScanBuildLog streams the build's build-log.txt and returns the signatures
+// it matches, in the order they first match. Builds without a log match
+// nothing.
+func ScanBuildLog(ctx context.Context, artifacts *Artifacts, build Build, sigs *Signatures) ([]SignatureMatch, error) {
+	rc, err := artifacts.Open(ctx, build, BuildLog)
+	if err != nil {
+		if Classify(err) == ErrorNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer rc.Close()
+
+	var matches []SignatureMatch
+	matched := map[string]bool{}
+	r := bufio.NewReaderSize(rc, maxLogLine)
+	for n := 1; len(matched) < len(sigs.Signatures); n++ {
+		line, err := readLine(r)
+		if len(line) > 0 {
+			for _, sig := range sigs.Signatures {
+				if matched[sig.Name] || !sig.re.Match(line) {
+					continue
+				}
+				matched[sig.Name] = true
+				text := line
+				if len(text) > MaxSignatureText {
+					text = text[:MaxSignatureText]
+				}
+				matches = append(matches, SignatureMatch{Name: sig.Name, Line: n, Text: string(text)})
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return matches, buildError(build, err)
+		}
+	}
+	return matches, nil
+}
+
+// readLine returns the next line of r without its line ending. Only the first
+// maxLogLine bytes of longer lines are returned; the rest is skipped.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// copy before the buffer is reused to skip the rest
+		line = append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull {
+			_, err = r.ReadSlice('\n')
+		}
+	}
+	return bytes.TrimRight(line, "\r\n"), err
+}
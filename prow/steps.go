@@ -0,0 +1,94 @@
+package prow
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// StepGraph is the name of the file ci-operator records the steps of a build
+// in.
+const StepGraph = "artifacts/ci-operator-step-graph.json"
+
+// Step results.
+const (
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	// StepUnknown is the result of steps that didn't finish, such as those
+	// still running or cut short by a failing dependency.
+	StepUnknown = "unknown"
+)
+
+// Step is a step run by ci-operator, or a step of a multi-stage test.
+type Step struct {
+	Name string
+	// Parent names the multi-stage test a step belongs to, if any.
+	Parent string
+	// Started is zero for steps that never started.
+	Started      time.Time
+	Duration     time.Duration
+	Result       string
+	Dependencies []string
+}
+
+// stepDetails is an entry of the step graph, matching ci-operator's
+// CIOperatorStepDetails.
+type stepDetails struct {
+	stepDetailInfo
+	Substeps []stepDetailInfo `json:"substeps,omitempty"`
+}
+
+type stepDetailInfo struct {
+	StepName     string         `json:"name"`
+	Dependencies []string       `json:"dependencies"`
+	StartedAt    *time.Time     `json:"started_at"`
+	Duration     *time.Duration `json:"duration,omitempty"`
+	Failed       *bool          `json:"failed,omitempty"`
+}
+
+func (info stepDetailInfo) step(parent string) Step {
+	step := Step{
+		Name:         info.StepName,
+		Parent:       parent,
+		Result:       StepUnknown,
+		Dependencies: info.Dependencies,
+	}
+	if info.StartedAt != nil {
+		step.Started = *info.StartedAt
+	}
+	if info.Duration != nil {
+		step.Duration = *info.Duration
+	}
+	if info.Failed != nil {
+		step.Result = StepSucceeded
+		if *info.Failed {
+			step.Result = StepFailed
+		}
+	}
+	return step
+}
+
+// GetSteps reads the steps of a build from its ci-operator step graph. Steps
+// are returned in the order of the graph, each followed by its substeps.
+// Builds not run by ci-operator have no steps.
+func GetSteps(ctx context.Context, artifacts *Artifacts, build Build) ([]Step, error) {
+	data, err := artifacts.Read(ctx, build, StepGraph)
+	if err != nil {
+		if Classify(err) == ErrorNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var graph []stepDetails
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return nil, buildError(build, &ObjectError{Key: build.Prefix + "/" + StepGraph, Class: ErrorPermanent, Err: err})
+	}
+	var steps []Step
+	for _, details := range graph {
+		steps = append(steps, details.step(""))
+		for _, substep := range details.Substeps {
+			steps = append(steps, substep.step(details.StepName))
+		}
+	}
+	return steps, nil
+}